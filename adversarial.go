@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	// hash-region keys only put their bits in the first 1/ADVERSARIAL_REGION
+	// of the filter. mining them costs about ADVERSARIAL_REGION^k hashes a key
+	ADVERSARIAL_REGION = 4
+	// hashes mining may spend on all the keys. the region grows towards half
+	// the filter as k grows to stay under it, past that mining stops short
+	ADVERSARIAL_MAX_ATTEMPTS = 1 << 24
+	RANDOM_KEY_ALPHABET      = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// n random keys of 8 to 32 characters. the prefix keeps the inserted and
+// the probe sets disjoint whatever the rng draws
+func randomKeys(rng *rand.Rand, n int, prefix string) []string {
+	keys := make([]string, n)
+	buf := make([]byte, 32)
+	for i := range keys {
+		size := 8 + rng.IntN(25)
+		for j := range size {
+			buf[j] = RANDOM_KEY_ALPHABET[rng.IntN(len(RANDOM_KEY_ALPHABET))]
+		}
+		keys[i] = prefix + string(buf[:size])
+	}
+	return keys
+}
+
+// n keys to insert and n disjoint ones to probe
+type keyFamily struct {
+	name string
+	gen  func(m, k uint, n int) (inserted, probes []string)
+}
+
+var adversarialFamilies = []keyFamily{
+	{"random", func(m, k uint, n int) ([]string, []string) {
+		rng := rand.New(rand.NewPCG(1, 2))
+		return randomKeys(rng, n, "+"), randomKeys(rng, n, "-")
+	}},
+	// ids as the synthetic events number them
+	{"sequential", func(m, k uint, n int) ([]string, []string) {
+		return counterKeys("", 40000000000, n), counterKeys("", 40000000000+n, n)
+	}},
+	{"shared-prefix", func(m, k uint, n int) ([]string, []string) {
+		prefix := strings.Repeat("github.com/some-org/some-repo/", 8)
+		return counterKeys(prefix, 0, n), counterKeys(prefix, n, n)
+	}},
+	// identical but for their last three bytes
+	{"low-bytes", func(m, k uint, n int) ([]string, []string) {
+		base := strings.Repeat("x", 29)
+		keys := make([]string, 2*n)
+		for i := range keys {
+			keys[i] = base + string([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+		}
+		return keys[:n], keys[n:]
+	}},
+	// every location of every key, probes included, in one corner of the
+	// filter, what an attacker who knows m and k can mine offline
+	{"hash-region", func(m, k uint, n int) ([]string, []string) {
+		region := hashRegion(k, 2*n)
+		keys := make([]string, 0, 2*n)
+		for i := 0; len(keys) < 2*n && i < ADVERSARIAL_MAX_ATTEMPTS; i++ {
+			key := fmt.Sprint("r", i)
+			if inRegion(key, m, k, m/region) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) < 2*n {
+			slog.Warn("hash-region mining stopped short", "k", k, "region", region, "attempts", ADVERSARIAL_MAX_ATTEMPTS, "keys", len(keys), "want", 2*n)
+		}
+		return keys[:len(keys)/2], keys[len(keys)/2:]
+	}},
+}
+
+// the largest fraction 1/region, at most 1/ADVERSARIAL_REGION and at least
+// half, whose keys are expected within ADVERSARIAL_MAX_ATTEMPTS
+func hashRegion(k uint, keys int) uint {
+	for region := uint(ADVERSARIAL_REGION); region > 2; region-- {
+		if math.Pow(float64(region), float64(k))*float64(keys) <= ADVERSARIAL_MAX_ATTEMPTS {
+			return region
+		}
+	}
+	return 2
+}
+
+func counterKeys(prefix string, from, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprint(prefix, from+i)
+	}
+	return keys
+}
+
+// whether all k of key's locations in a filter of m bits fall below limit
+func inRegion(key string, m, k, limit uint) bool {
+	for _, h := range bloom.Locations([]byte(key), k) {
+		if uint(h%uint64(m)) >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+// inserts each family's keys into a map and a bloom sized by -n and -fp,
+// or pinned by -bloom-m and -bloom-k, and probes both with keys never
+// inserted. the gap is measured over theoretical fp, about 1 while the
+// double hashing spreads the keys
+func RunAdversarial(cfg *Config) {
+	n := int(cfg.N)
+	m, k := bloom.EstimateParameters(cfg.N, cfg.FP)
+	if cfg.BloomM > 0 {
+		m, k = cfg.BloomM, cfg.BloomK
+	}
+	for _, fam := range adversarialFamilies {
+		start := time.Now()
+		inserted, probes := fam.gen(m, k, n)
+		genTime := time.Since(start)
+		if len(inserted) == 0 {
+			slog.Warn("adversarial", "keys", fam.name, "skipped", "no keys generated")
+			continue
+		}
+
+		set := map[string]bool{}
+		mapInsert := timeIt(func() {
+			for _, key := range inserted {
+				set[key] = true
+			}
+		})
+		hits := 0
+		mapLookup := timeIt(func() {
+			for _, key := range probes {
+				if set[key] {
+					hits += 1
+				}
+			}
+		})
+
+		fil := bloom.New(m, k)
+		bloomInsert := timeIt(func() {
+			for _, key := range inserted {
+				fil.AddString(key)
+			}
+		})
+		report := fpReport(fil, len(set), probes)
+
+		slog.Info(
+			"adversarial",
+			"keys", fam.name,
+			"n", n,
+			"distinct", len(set),
+			"m", m,
+			"k", k,
+			"gen_ms", genTime.Milliseconds(),
+			"map_probe_hits", hits,
+			"map_insert_ns", mapInsert.Nanoseconds()/int64(len(inserted)),
+			"map_lookup_ns", mapLookup.Nanoseconds()/int64(max(len(probes), 1)),
+			"bloom_insert_ns", bloomInsert.Nanoseconds()/int64(len(inserted)),
+			"bits_set_pct", 100*float64(fil.BitSet().Count())/float64(m),
+			"measured_fp", report.MeasuredRate,
+			"theoretical_fp", report.TheoreticalRate,
+			"fp_gap", report.MeasuredRate/report.TheoreticalRate,
+		)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+// the region widens as k grows so the expected mining cost stays under
+// ADVERSARIAL_MAX_ATTEMPTS, half the filter is as wide as it gets
+func TestHashRegion(t *testing.T) {
+	for _, tc := range []struct {
+		k    uint
+		keys int
+		want uint
+	}{
+		{4, 24000, 4},
+		{7, 24000, 2},
+		{7, 200, 4},
+		{10, 200, 3},
+		{30, 24000, 2},
+	} {
+		if got := hashRegion(tc.k, tc.keys); got != tc.want {
+			t.Errorf("k=%d keys=%d: got 1/%d, want 1/%d", tc.k, tc.keys, got, tc.want)
+		}
+	}
+}
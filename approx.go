@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log/slog"
+)
+
+// samples each filter's ApproximatedSize every -approx-every inserts. the
+// map pass records the exact distinct count at the same points, both passes
+// read the input in the same order so the samples line up without keeping
+// a second exact set during the bloom pass
+type ApproxSampler struct {
+	every   int
+	key     KeyFunc
+	mp      *MapProcessor
+	fils    []*Filter
+	inserts int
+	exact   []int
+	approx  map[string][]uint32
+}
+
+func NewApproxSampler(every int, key KeyFunc, mp *MapProcessor, fils []*Filter) *ApproxSampler {
+	return &ApproxSampler{every: every, key: key, mp: mp, fils: fils, approx: map[string][]uint32{}}
+}
+
+// wraps the map proc, inserts are counted off the map so the key is not
+// derived twice
+func (s *ApproxSampler) WrapMap(proc func(*Model)) func(*Model) {
+	return func(md *Model) {
+		proc(md)
+		inserts := s.mp.inserts
+		if inserts == s.inserts {
+			return
+		}
+		s.inserts = inserts
+		if inserts%s.every == 0 {
+			s.exact = append(s.exact, len(s.mp.set))
+		}
+	}
+}
+
+func (s *ApproxSampler) WrapBloom(proc func(*Model)) func(*Model) {
+	inserts := 0
+	return func(md *Model) {
+		proc(md)
+		if _, ok := s.key(md); !ok {
+			return
+		}
+		inserts += 1
+		if inserts%s.every != 0 {
+			return
+		}
+		for _, f := range s.fils {
+			s.approx[f.name] = append(s.approx[f.name], f.fil.ApproximatedSize())
+		}
+	}
+}
+
+func approxError(approx uint32, exact int) float64 {
+	return 100 * (float64(approx) - float64(exact)) / float64(max(exact, 1))
+}
+
+// the estimate comes from the fill of the bits so it drifts once a filter
+// is past the capacity it was sized for
+func (s *ApproxSampler) Report() {
+	for _, f := range s.fils {
+		for i, approx := range s.approx[f.name] {
+			if i >= len(s.exact) {
+				break
+			}
+			exact := s.exact[i]
+			slog.Info(
+				"approx size",
+				"filter", f.name,
+				"inserts", (i+1)*s.every,
+				"exact", exact,
+				"approx", approx,
+				"error_pct", approxError(approx, exact),
+				"load", float64(exact)/float64(f.n),
+			)
+		}
+	}
+	reportApproxSize(s.fils, len(s.mp.set))
+}
+
+// the end state of every filter against the map
+func reportApproxSize(fils []*Filter, exact int) {
+	for _, f := range fils {
+		approx := f.fil.ApproximatedSize()
+		slog.Info(
+			"approx size accuracy",
+			"filter", f.name,
+			"exact", exact,
+			"approx", approx,
+			"error_pct", approxError(approx, exact),
+			"load", float64(exact)/float64(f.n),
+		)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// saved artifacts start with
+//
+//	[4]byte magic "BVMH"
+//	uint32  big endian length of the json header
+//	[]byte  json ArtifactHeader
+//
+// followed by the gob payload. files without the magic predate the header
+// and are all payload
+var headerMagic = []byte("BVMH")
+
+// where the map, filter and checkpoint artifacts are written and reloaded
+// from, set by -outdir
+var outDir = "."
+
+func artifactPath(name string) string {
+	return filepath.Join(outDir, name)
+}
+
+func setupOutDir(cfg *Config) error {
+	outDir = cfg.OutDir
+	if outDir == "" {
+		outDir = "."
+	}
+	return os.MkdirAll(outDir, 0o755)
+}
+
+type ArtifactHeader struct {
+	Kind      string  `json:"kind"`
+	Source    string  `json:"source"`
+	EventType string  `json:"event_type"`
+	Key       string  `json:"key,omitempty"`
+	N         uint    `json:"n,omitempty"`
+	FP        float64 `json:"fp,omitempty"`
+	Entries   int     `json:"entries"`
+	Approx    uint32  `json:"approx,omitempty"`
+	// what -hash-seed pre-hashed the keys with, 0 for none
+	HashSeed uint64    `json:"hash_seed,omitempty"`
+	Created  time.Time `json:"created"`
+	Build    BuildInfo `json:"build"`
+}
+
+func (h *ArtifactHeader) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("kind", h.Kind),
+		slog.String("source", h.Source),
+		slog.String("event_type", h.EventType),
+		slog.String("key", h.Key),
+		slog.Uint64("n", uint64(h.N)),
+		slog.Float64("fp", h.FP),
+		slog.Int("entries", h.Entries),
+		slog.Uint64("approx", uint64(h.Approx)),
+		slog.Uint64("hash_seed", h.HashSeed),
+		slog.Time("created", h.Created),
+		slog.String("build", h.Build.String()),
+	)
+}
+
+func NewArtifactHeader(cfg *Config, kind string, n uint, fp float64, entries int) *ArtifactHeader {
+	return &ArtifactHeader{
+		Kind:      kind,
+		Source:    redactedInput(cfg),
+		EventType: "PushEvent",
+		Key:       cfg.Key,
+		N:         n,
+		FP:        fp,
+		Entries:   entries,
+		HashSeed:  cfg.HashSeed,
+		Created:   time.Now().UTC(),
+		Build:     ReadBuildInfo(),
+	}
+}
+
+func withHeader(hdr *ArtifactHeader, payload []byte) ([]byte, error) {
+	js, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(headerMagic) + 4 + len(js) + len(payload))
+	buf.Write(headerMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(js)))
+	buf.Write(js)
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+// a nil header means the artifact has none and data is all payload
+func splitHeader(data []byte) (*ArtifactHeader, []byte, error) {
+	if !bytes.HasPrefix(data, headerMagic) {
+		return nil, data, nil
+	}
+	rest := data[len(headerMagic):]
+	if len(rest) < 4 {
+		return nil, nil, fmt.Errorf("artifact header truncated")
+	}
+	size := binary.BigEndian.Uint32(rest)
+	rest = rest[4:]
+	if uint64(len(rest)) < uint64(size) {
+		return nil, nil, fmt.Errorf("artifact header wants %d bytes, have %d", size, len(rest))
+	}
+	hdr := &ArtifactHeader{}
+	if err := json.Unmarshal(rest[:size], hdr); err != nil {
+		return nil, nil, fmt.Errorf("artifact header: %w", err)
+	}
+	return hdr, rest[size:], nil
+}
+
+func SaveArtifact(filename string, hdr *ArtifactHeader, payload []byte) error {
+	data, err := withHeader(hdr, payload)
+	if err != nil {
+		return err
+	}
+	return Save(filename, data)
+}
+
+// logs the header when there is one and returns the payload
+func LoadArtifact(filename string) (*ArtifactHeader, []byte, error) {
+	data, err := Load(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	hdr, payload, err := splitHeader(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if hdr != nil {
+		slog.Info("artifact", "file", filename, "header", hdr)
+	} else {
+		slog.Info("artifact", "file", filename, "header", "none")
+	}
+	return hdr, payload, nil
+}
+
+// the streaming counterpart of splitHeader, leaves r at the payload
+func readHeader(r *bufio.Reader) (*ArtifactHeader, error) {
+	magic, err := r.Peek(len(headerMagic))
+	if err != nil || !bytes.Equal(magic, headerMagic) {
+		// too short for a header is left for the payload decoder to report
+		return nil, nil
+	}
+	r.Discard(len(headerMagic))
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("artifact header truncated: %w", err)
+	}
+	hdr := &ArtifactHeader{}
+	if err := json.NewDecoder(io.LimitReader(r, int64(size))).Decode(hdr); err != nil {
+		return nil, fmt.Errorf("artifact header: %w", err)
+	}
+	return hdr, nil
+}
+
+// opens a saved artifact as a stream of its payload, so large artifacts
+// decode without the whole file in memory first
+func openArtifact(filename string) (*bufio.Reader, func() error, error) {
+	fi, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	fz, err := gzip.NewReader(fi)
+	if err != nil {
+		fi.Close()
+		return nil, nil, err
+	}
+	closer := func() error {
+		fz.Close()
+		return fi.Close()
+	}
+	r := bufio.NewReader(fz)
+	hdr, err := readHeader(r)
+	if err != nil {
+		closer()
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if hdr != nil {
+		slog.Debug("artifact", "file", filename, "header", hdr)
+	}
+	return r, closer, nil
+}
+
+// values stay bool as saved, gob cannot encode struct{}
+func LoadMap(filename string) (map[string]bool, error) {
+	r, closer, err := openArtifact(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	m := map[string]bool{}
+	if err := gob.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return m, nil
+}
+
+// the payload is GobEncode's m, k and bit set, which ReadFrom reads as is
+func LoadBloom(filename string) (*bloom.BloomFilter, error) {
+	r, closer, err := openArtifact(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	fil := &bloom.BloomFilter{}
+	if _, err := fil.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return fil, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// both with the header SaveArtifact writes and without, as older files are
+func TestLoadMap(t *testing.T) {
+	m := map[string]bool{}
+	for _, id := range syntheticIds(5000, "id-") {
+		m[id] = true
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	hdr := NewArtifactHeader(testConfig("events.json"), "map", 0, 0, len(m))
+
+	dir := t.TempDir()
+	withHdr, bare := filepath.Join(dir, "map.gob"), filepath.Join(dir, "bare.gob")
+	if err := SaveArtifact(withHdr, hdr, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(bare, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{withHdr, bare} {
+		loaded, err := LoadMap(file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !maps.Equal(loaded, m) {
+			t.Fatalf("%s: loaded %d keys, want the %d saved", file, len(loaded), len(m))
+		}
+	}
+}
+
+func TestLoadBloom(t *testing.T) {
+	fil := bloom.NewWithEstimates(5000, 0.01)
+	for _, id := range syntheticIds(5000, "id-") {
+		fil.AddString(id)
+	}
+	payload, err := fil.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := NewArtifactHeader(testConfig("events.json"), "bloom", 5000, 0.01, 5000)
+
+	dir := t.TempDir()
+	withHdr, bare := filepath.Join(dir, "bloom.gob"), filepath.Join(dir, "bare.gob")
+	if err := SaveArtifact(withHdr, hdr, payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(bare, payload); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{withHdr, bare} {
+		loaded, err := LoadBloom(file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !loaded.Equal(fil) {
+			t.Fatalf("%s: loaded filter differs from the saved one", file)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// a result metric guarded by -baseline, lower is better for all of them
+type baselineMetric struct {
+	name  string
+	value func(*Result) float64
+}
+
+var baselineMetrics = []baselineMetric{
+	{"map_time_ns", func(r *Result) float64 { return float64(r.MapInsert) }},
+	{"bloom_time_ns", func(r *Result) float64 { return float64(r.BloomConstruct + r.BloomInsert) }},
+	{"map_alloc_mb", func(r *Result) float64 { return float64(r.MapAllocMB) }},
+	{"bloom_alloc_mb", func(r *Result) float64 { return float64(r.BloomAllocMB) }},
+	{"map_retained_bytes", func(r *Result) float64 { return float64(r.MapRetained) }},
+	{"bloom_bytes", func(r *Result) float64 { return float64(r.BloomBytes) }},
+}
+
+func SaveBaseline(filename string, res *Result) error {
+	fi, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	if err := res.WriteJSON(fi); err != nil {
+		return err
+	}
+	return fi.Close()
+}
+
+func LoadBaseline(filename string) (*Result, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	base := &Result{}
+	if err := json.Unmarshal(data, base); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return base, nil
+}
+
+// every metric's change against the baseline, an error naming each one
+// that grew by more than threshold percent
+func compareBaseline(base, res *Result, threshold float64) error {
+	var errs []error
+	for _, m := range baselineMetrics {
+		was, now := m.value(base), m.value(res)
+		if was == 0 {
+			// no percentage of nothing, e.g alloc_mb rounds small runs to 0
+			slog.Info("baseline", "metric", m.name, "baseline", was, "current", now, "delta_pct", "n/a")
+			continue
+		}
+		delta := 100 * (now - was) / was
+		slog.Info("baseline", "metric", m.name, "baseline", was, "current", now, "delta_pct", delta)
+		if delta > threshold {
+			errs = append(errs, fmt.Errorf("%s regressed %.1f%%, %g to %g", m.name, delta, was, now))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fails the process when the run regressed against -baseline. with
+// -update-baseline the run becomes the new baseline instead
+func RunBaseline(cfg *Config, res *Result) {
+	if cfg.UpdateBaseline {
+		if err := SaveBaseline(cfg.Baseline, res); err != nil {
+			log.Fatalf("Error writing -baseline: %v", err)
+		}
+		slog.Info("baseline updated", "file", cfg.Baseline)
+		return
+	}
+	base, err := LoadBaseline(cfg.Baseline)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("no baseline at %s, create it with -update-baseline", cfg.Baseline)
+	}
+	if err != nil {
+		log.Fatalf("Error loading -baseline: %v", err)
+	}
+	if base.Input != res.Input || base.N != res.N || base.FP != res.FP {
+		slog.Warn("baseline was measured differently", "input", base.Input, "n", base.N, "fp", base.FP)
+	}
+	if err := compareBaseline(base, res, cfg.BaselinePct); err != nil {
+		log.Fatalf("regressed past %.1f%% of %s: %s", cfg.BaselinePct, cfg.Baseline, strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	slog.Info("within baseline", "file", cfg.Baseline, "threshold_pct", cfg.BaselinePct)
+}
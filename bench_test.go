@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// keeps benchmarked results alive so the work isn't optimised away
+var benchSink int
+
+// TestMany against the loop it replaces, over a filter holding every id
+func BenchmarkTestMany(b *testing.B) {
+	fil := bloom.NewWithEstimates(BLOOM_N, BLOOM_FP)
+	ids := syntheticIds(BLOOM_N, "id-")
+	for _, id := range ids {
+		fil.AddString(id)
+	}
+
+	b.Run("loop", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			positives := 0
+			for _, id := range ids {
+				if fil.TestString(id) {
+					positives += 1
+				}
+			}
+			benchSink = positives
+		}
+	})
+	b.Run("TestMany", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			benchSink = TestMany(fil, ids)
+		}
+	})
+}
+
+// fills of a filter sized for BLOOM_N, past 100% it is over capacity
+var benchFills = []float64{0.25, 0.5, 0.75, 1, 2}
+
+func filledFilter(fill float64) (*bloom.BloomFilter, []string) {
+	fil := bloom.NewWithEstimates(BLOOM_N, BLOOM_FP)
+	ids := syntheticIds(int(fill*BLOOM_N), "id-")
+	for _, id := range ids {
+		fil.AddString(id)
+	}
+	return fil, ids
+}
+
+// lookups of inserted ids as the filter fills up
+func BenchmarkTestStringHit(b *testing.B) {
+	for _, fill := range benchFills {
+		fil, ids := filledFilter(fill)
+		b.Run(fmt.Sprintf("fill=%.0f%%", fill*100), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if fil.TestString(ids[i%len(ids)]) {
+					benchSink += 1
+				}
+			}
+		})
+	}
+}
+
+// lookups of ids never inserted, the fp metric is the degradation curve
+func BenchmarkTestStringMiss(b *testing.B) {
+	negatives := syntheticIds(BLOOM_N, "miss-")
+	for _, fill := range benchFills {
+		fil, _ := filledFilter(fill)
+		b.Run(fmt.Sprintf("fill=%.0f%%", fill*100), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if fil.TestString(negatives[i%len(negatives)]) {
+					benchSink += 1
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(TestMany(fil, negatives))/float64(len(negatives)), "fp")
+		})
+	}
+}
+
+// serialized size against the accuracy asked for, over the same ids. the
+// size grows with -ln(fp) since m = -n ln(fp) / ln(2)^2
+func BenchmarkGobEncode(b *testing.B) {
+	ids := syntheticIds(BLOOM_N, "id-")
+	table := "fp\tm\tk\tgob_bytes\tbits_per_entry"
+	for _, fp := range []float64{0.5, 0.1, 0.05, 0.01, 0.001, 0.0001} {
+		fil := bloom.NewWithEstimates(BLOOM_N, fp)
+		for _, id := range ids {
+			fil.AddString(id)
+		}
+		data, err := fil.GobEncode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		table += fmt.Sprintf("\n%g\t%d\t%d\t%d\t%.2f", fp, fil.Cap(), fil.K(), len(data), float64(len(data)*8)/float64(len(ids)))
+
+		b.Run(fmt.Sprintf("fp=%g", fp), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := fil.GobEncode()
+				if err != nil {
+					b.Fatal(err)
+				}
+				benchSink = len(data)
+			}
+			b.ReportMetric(float64(len(data)), "gob_bytes")
+		})
+	}
+	b.Log("\n" + table)
+}
+
+// an encode and decode pair for one persistence format
+type serialFormat struct {
+	name   string
+	encode func(*bloom.BloomFilter) ([]byte, error)
+	decode func([]byte) (*bloom.BloomFilter, error)
+}
+
+var serialFormats = []serialFormat{
+	{
+		name:   "gob",
+		encode: func(f *bloom.BloomFilter) ([]byte, error) { return f.GobEncode() },
+		decode: func(data []byte) (*bloom.BloomFilter, error) {
+			f := &bloom.BloomFilter{}
+			return f, f.GobDecode(data)
+		},
+	},
+	{
+		name:   "json",
+		encode: func(f *bloom.BloomFilter) ([]byte, error) { return f.MarshalJSON() },
+		decode: func(data []byte) (*bloom.BloomFilter, error) {
+			f := &bloom.BloomFilter{}
+			return f, f.UnmarshalJSON(data)
+		},
+	},
+	{
+		// the bit set alone, m and k travel separately as in SaveRaw
+		name: "raw",
+		encode: func(f *bloom.BloomFilter) ([]byte, error) {
+			var buf bytes.Buffer
+			_, err := f.BitSet().WriteTo(&buf)
+			return buf.Bytes(), err
+		},
+		decode: func(data []byte) (*bloom.BloomFilter, error) {
+			f := bloom.New(serialM, serialK)
+			_, err := f.BitSet().ReadFrom(bytes.NewReader(data))
+			return f, err
+		},
+	},
+}
+
+// the filter the serialize benchmark round trips, the raw format needs its
+// m and k up front
+var serialM, serialK = bloom.EstimateParameters(100*BLOOM_N, BLOOM_FP)
+
+// encode and decode throughput and size per format over a filter sized for
+// 100x BLOOM_N, big enough that the bit set dominates any framing
+func BenchmarkSerialize(b *testing.B) {
+	fil := bloom.New(serialM, serialK)
+	for _, id := range syntheticIds(100*BLOOM_N, "id-") {
+		fil.AddString(id)
+	}
+
+	for _, format := range serialFormats {
+		data, err := format.encode(fil)
+		if err != nil {
+			b.Fatalf("encoding %s: %v", format.name, err)
+		}
+		decoded, err := format.decode(data)
+		if err != nil {
+			b.Fatalf("decoding %s: %v", format.name, err)
+		}
+		if !decoded.Equal(fil) {
+			b.Fatalf("%s round trip changed the filter", format.name)
+		}
+
+		b.Run(format.name+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				out, err := format.encode(fil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				benchSink = len(out)
+			}
+			b.ReportMetric(float64(len(data)), "out_bytes")
+		})
+		b.Run(format.name+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := format.decode(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// a json array of n events, most of them pushes like the github feed
+func syntheticEvents(b *testing.B, n int) []byte {
+	events := make([]Model, n)
+	for i := range events {
+		md := &events[i]
+		md.Id = fmt.Sprint(40000000000 + i)
+		md.Type = "PushEvent"
+		if i%5 == 0 {
+			md.Type = "WatchEvent"
+		}
+		md.CreatedAt = "2024-01-01T00:00:00Z"
+		md.Actor.Login = fmt.Sprintf("user-%d", i%700)
+		md.Repo.Name = fmt.Sprintf("user-%d/repo-%d", i%700, i%900)
+		md.Payload.Head = fmt.Sprintf("%040x", i)
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// ReadAllStreaming hands the file straight to the decoder while
+// ReadAllStreamingBuffered puts a bufio.Reader in between, this decodes the
+// same file unbuffered and at a few buffer sizes
+func BenchmarkDecodeBuffered(b *testing.B) {
+	data := syntheticEvents(b, BLOOM_N)
+	input := writeInput(b, "events.json", data)
+
+	// 0 for no buffer, 4096 is what ReadAllStreamingBuffered uses
+	for _, size := range []int{0, 4096, 64 << 10, 1 << 20} {
+		name := "unbuffered"
+		if size > 0 {
+			name = fmt.Sprintf("bufio=%dk", size>>10)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				f, err := os.Open(input)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var in io.Reader = f
+				if size > 0 {
+					in = bufio.NewReaderSize(f, size)
+				}
+				count, err := decodeStream(context.Background(), in, "events", func(*Model) {})
+				f.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+				benchSink = count
+			}
+		})
+	}
+}
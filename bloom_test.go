@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	// standard deviations of the measured rate allowed over the expected
+	// one before a seed fails, the measured rate is a binomial estimate
+	PROPERTY_SIGMAS = 4
+	// the library's double hashing runs a few percent over the formula
+	PROPERTY_FP_MARGIN = 1.1
+)
+
+// the property everything else rests on: a bloom never forgets a key and
+// stays near the fp it was sized for. seeds are fixed so a failure repeats
+func TestBloomProperties(t *testing.T) {
+	for _, tc := range []struct {
+		n  uint
+		fp float64
+	}{
+		{1000, 0.1},
+		{12000, 0.01},
+		{5000, 0.001},
+	} {
+		for seed := uint64(1); seed <= 20; seed++ {
+			rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+			n := int(tc.n)
+			fil := bloom.NewWithEstimates(tc.n, tc.fp)
+			inserted := randomKeys(rng, n, "+")
+			for _, key := range inserted {
+				fil.AddString(key)
+			}
+			for _, key := range inserted {
+				if !fil.TestString(key) {
+					t.Fatalf("n=%d fp=%g seed %d: false negative for %q", tc.n, tc.fp, seed, key)
+				}
+			}
+
+			positives := 0
+			for _, key := range randomKeys(rng, n, "-") {
+				if fil.TestString(key) {
+					positives += 1
+				}
+			}
+			rate := float64(positives) / float64(n)
+			// k is rounded from the estimate so the formula may sit a little over fp
+			expected := max(tc.fp, theoreticalFP(fil, n))
+			limit := PROPERTY_FP_MARGIN*expected + PROPERTY_SIGMAS*math.Sqrt(expected*(1-expected)/float64(n))
+			if rate > limit {
+				t.Errorf("n=%d fp=%g seed %d: measured fp %.4f over %.4f", tc.n, tc.fp, seed, rate, limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+	"sort"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	BUCKET_HOUR = "hour"
+	BUCKET_DAY  = "day"
+)
+
+// one run's map and bloom per bucket key
+type Buckets struct {
+	blooms map[string]*bloom.BloomFilter
+	maps   map[string]map[string]bool
+}
+
+func NewBuckets() *Buckets {
+	return &Buckets{blooms: map[string]*bloom.BloomFilter{}, maps: map[string]map[string]bool{}}
+}
+
+// truncate created_at to the bucket granularity, keys sort chronologically
+func bucketKey(md *Model, granularity string) (string, error) {
+	t, err := md.CreatedTime()
+	if err != nil {
+		return "", err
+	}
+	t = t.UTC()
+	if granularity == BUCKET_DAY {
+		return t.Format("2006-01-02"), nil
+	}
+	return t.Format("2006-01-02T15"), nil
+}
+
+func (b *Buckets) ProcessChunkUsingBucketMap(cfg *Config) func(*Model) {
+	return func(md *Model) {
+		id, ok := cfg.keyFunc(md)
+		if !ok {
+			return
+		}
+		key, err := bucketKey(md, cfg.BucketBy)
+		if err != nil {
+			slog.Warn("skipping entry, bad created_at", "id", md.Id, "err", err)
+			return
+		}
+		ids, ok := b.maps[key]
+		if !ok {
+			ids = map[string]bool{}
+			b.maps[key] = ids
+		}
+		ids[id] = true
+	}
+}
+
+func (b *Buckets) ProcessChunkUsingBucketBloom(cfg *Config) func(*Model) {
+	return func(md *Model) {
+		id, ok := cfg.keyFunc(md)
+		if !ok {
+			return
+		}
+		key, err := bucketKey(md, cfg.BucketBy)
+		if err != nil {
+			slog.Warn("skipping entry, bad created_at", "id", md.Id, "err", err)
+			return
+		}
+		fil, ok := b.blooms[key]
+		if !ok {
+			fil = bloom.NewWithEstimates(b.capacity(cfg, key), cfg.FP)
+			b.blooms[key] = fil
+		}
+		fil.AddString(id)
+	}
+}
+
+// the bucket's share of -n by the entries the map pass counted in it,
+// bounded by -bucket-cap
+func (b *Buckets) capacity(cfg *Config, key string) uint {
+	total := 0
+	for _, ids := range b.maps {
+		total += len(ids)
+	}
+	if total == 0 {
+		return cfg.BucketCap
+	}
+	share := uint(float64(cfg.N) * float64(len(b.maps[key])) / float64(total))
+	return min(max(share, 1), cfg.BucketCap)
+}
+
+func (b *Buckets) Report() {
+	keys := make([]string, 0, len(b.blooms))
+	for k := range b.blooms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var totalBits int
+	for _, k := range keys {
+		fil := b.blooms[k]
+		size := fil.BitSet().BinaryStorageSize()
+		totalBits += size
+		slog.Info("bucket", "bucket", k, "count", len(b.maps[k]), "bloom_approx", fil.ApproximatedSize(), "bloom_bytes", size)
+	}
+	slog.Info("buckets", "count", len(keys), "bloom_bytes", totalBits)
+}
+
+func (b *Buckets) Query(cfg *Config) {
+	fil, ok := b.blooms[cfg.QueryBucket]
+	if !ok {
+		slog.Warn("query: no such bucket", "bucket", cfg.QueryBucket)
+		return
+	}
+	id := cfg.normalizeKey(cfg.QueryId)
+	_, inMap := b.maps[cfg.QueryBucket][id]
+	slog.Info("query", "bucket", cfg.QueryBucket, "id", id, "bloom", fil.TestString(id), "map", inMap)
+}
+
+func RunBuckets(ctx context.Context, cfg *Config) {
+	if cfg.BucketBy != BUCKET_HOUR && cfg.BucketBy != BUCKET_DAY {
+		log.Fatalf("unknown bucket granularity %q, want %s or %s", cfg.BucketBy, BUCKET_HOUR, BUCKET_DAY)
+	}
+
+	b := NewBuckets()
+	var m1, m2, m3 runtime.MemStats
+
+	runtime.ReadMemStats(&m1)
+	Stage(ctx, "bucket-map", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(b.ProcessChunkUsingBucketMap(cfg))); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+	runtime.ReadMemStats(&m2)
+	cycles, pause := gcDelta(&m1, &m2)
+	slog.Info("mem usage", "mode", "bucket-map", "alloc", humanDelta(m1.Alloc, m2.Alloc), "heap", humanDelta(m1.HeapAlloc, m2.HeapAlloc), "num_gc", cycles, "gc_pause_us", pause.Microseconds())
+	Stage(ctx, "bucket-bloom", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(b.ProcessChunkUsingBucketBloom(cfg))); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+	runtime.ReadMemStats(&m3)
+	cycles, pause = gcDelta(&m2, &m3)
+	slog.Info("mem usage", "mode", "bucket-bloom", "alloc", humanDelta(m2.Alloc, m3.Alloc), "heap", humanDelta(m2.HeapAlloc, m3.HeapAlloc), "num_gc", cycles, "gc_pause_us", pause.Microseconds())
+
+	b.Report()
+	if cfg.QueryBucket != "" {
+		b.Query(cfg)
+	}
+}
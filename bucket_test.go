@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// three hours holding 600, 300 and 100 pushes. every bucket bloom counts
+// what its map holds and is sized for its share of -n at -fp
+func TestBucketCounts(t *testing.T) {
+	cfg := testConfig("events.json")
+	cfg.N, cfg.FP, cfg.BucketCap = 1000, 0.01, 12000
+	cfg.BucketBy = BUCKET_HOUR
+
+	var events []Model
+	for hour, pushes := range []int{600, 300, 100} {
+		for i := range pushes {
+			events = append(events, Model{
+				Id:        fmt.Sprintf("%d-%d", hour, i),
+				Type:      "PushEvent",
+				CreatedAt: fmt.Sprintf("2024-01-01T%02d:%02d:00Z", hour, i%60),
+			})
+		}
+	}
+	b := NewBuckets()
+	for _, proc := range []func(*Model){b.ProcessChunkUsingBucketMap(cfg), b.ProcessChunkUsingBucketBloom(cfg)} {
+		for i := range events {
+			proc(&events[i])
+		}
+	}
+
+	if len(b.blooms) != 3 || len(b.maps) != 3 {
+		t.Fatalf("%d blooms and %d maps, want 3 of each", len(b.blooms), len(b.maps))
+	}
+	for key, ids := range b.maps {
+		fil, ok := b.blooms[key]
+		if !ok {
+			t.Fatalf("bucket %s has a map and no bloom", key)
+		}
+		if m, _ := bloom.EstimateParameters(uint(len(ids)), cfg.FP); fil.Cap() != m {
+			t.Fatalf("bucket %s has %d bits, want %d for its %d entries", key, fil.Cap(), m, len(ids))
+		}
+		if approx := float64(fil.ApproximatedSize()); math.Abs(approx-float64(len(ids))) > 0.05*float64(len(ids)) {
+			t.Fatalf("bucket %s estimates %.0f, the map holds %d", key, approx, len(ids))
+		}
+		for id := range ids {
+			if !fil.TestString(id) {
+				t.Fatalf("bucket %s lost %q", key, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the cached copy of an http input, keyed by its url
+func cachePath(cfg *Config) string {
+	sum := sha256.Sum256([]byte(cfg.Input))
+	return filepath.Join(cfg.Cache, hex.EncodeToString(sum[:8])+".input")
+}
+
+// downloads the input into the cache unless it is already there. a partial
+// download is kept beside it and resumed with a range request on the next
+// attempt, so an interrupted fetch does not start over from zero
+func cachedInput(ctx context.Context, cfg *Config) (string, error) {
+	path := cachePath(cfg)
+	if _, err := os.Stat(path); err == nil {
+		fresh, err := cacheFresh(ctx, cfg, path)
+		switch {
+		case err != nil:
+			slog.Warn("could not check the cached input is current, using it", "url", redactedInput(cfg), "err", err)
+		case !fresh && cfg.RefreshCache:
+			slog.Info("remote input changed since it was cached, downloading it again", "url", redactedInput(cfg))
+		case !fresh:
+			slog.Warn("remote input changed since it was cached, results are not comparable with runs over the fresh copy, -refresh-cache downloads it again", "url", redactedInput(cfg))
+		}
+		if err != nil || fresh || !cfg.RefreshCache {
+			slog.Info("input", "copy", "cached", "url", redactedInput(cfg), "path", path)
+			return path, nil
+		}
+		if err := os.Remove(path); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(cfg.Cache, 0o755); err != nil {
+		return "", err
+	}
+
+	part := path + ".part"
+	var err error
+	for attempt := 1; attempt <= max(cfg.Retries, 1); attempt++ {
+		var size int64
+		if size, err = resumeDownload(ctx, cfg, part); err == nil {
+			err = checkDownloadSize(part, size)
+		}
+		if err == nil {
+			slog.Info("input", "copy", "fresh", "url", redactedInput(cfg), "path", path)
+			return path, os.Rename(part, path)
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		slog.Warn("download interrupted", "url", redactedInput(cfg), "attempt", attempt, "err", err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	return "", err
+}
+
+// a reassembled download has to be exactly as long as the server said the
+// whole input is. a longer one can not be fixed by resuming, it starts over
+func checkDownloadSize(part string, size int64) error {
+	if size < 0 {
+		return nil
+	}
+	fi, err := os.Stat(part)
+	if err != nil {
+		return err
+	}
+	if fi.Size() == size {
+		return nil
+	}
+	if fi.Size() > size {
+		if err := os.Remove(part); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("downloaded %d bytes, the server reported %d", fi.Size(), size)
+}
+
+// the total length from a Content-Range of bytes a-b/total or bytes */total,
+// -1 when it is missing or unknown
+func contentRangeSize(h http.Header) int64 {
+	cr := h.Get("Content-Range")
+	i := strings.LastIndexByte(cr, '/')
+	if i < 0 {
+		return -1
+	}
+	size, err := strconv.ParseInt(cr[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// appends to part from wherever the last attempt stopped and returns the
+// length of the whole input, -1 if the server did not say
+func resumeDownload(ctx context.Context, cfg *Config, part string) (size int64, err error) {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1, err
+	}
+
+	req, err := newRequest(ctx, cfg)
+	if err != nil {
+		return -1, err
+	}
+	// the part is only resumed under the validator it was downloaded with,
+	// a server holding a changed input answers the If-Range with all of it
+	var meta cacheMeta
+	if offset > 0 {
+		if meta, err = loadCacheMeta(cachePath(cfg)); err == nil && meta.ifRange() != "" {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", meta.ifRange())
+		} else {
+			slog.Info("partial download has no validator, restarting it", "url", redactedInput(cfg))
+		}
+	}
+	// no overall timeout, a large download is only bounded by ctx
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// a server ignoring If-Range still gives itself away by its etag
+		if etag := resp.Header.Get("ETag"); meta.ETag != "" && etag != "" && etag != meta.ETag {
+			if err := f.Truncate(0); err != nil {
+				return -1, err
+			}
+			return -1, fmt.Errorf("input changed mid download, etag %s then %s", meta.ETag, etag)
+		}
+		size = contentRangeSize(resp.Header)
+		if err := saveCacheMeta(cachePath(cfg), resp.Header); err != nil {
+			return -1, err
+		}
+	case http.StatusOK:
+		size = resp.ContentLength
+		if err := saveCacheMeta(cachePath(cfg), resp.Header); err != nil {
+			return -1, err
+		}
+		// the server ignored the range or the input changed, start again
+		if offset > 0 {
+			slog.Info("server does not support resume, restarting download", "url", redactedInput(cfg))
+		}
+		if err := f.Truncate(0); err != nil {
+			return -1, err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return -1, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// everything up to the end was already written, or the part
+		// outgrew the input and the size check throws it away
+		return contentRangeSize(resp.Header), nil
+	default:
+		return -1, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	n, err := io.Copy(f, resp.Body)
+	slog.Info("downloaded", "url", redactedInput(cfg), "resumed_at", offset, "bytes", n)
+	if err != nil {
+		return -1, err
+	}
+	// a body cut short without a length mismatch error still counts as an interruption
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return -1, errors.New("short body")
+	}
+	return size, nil
+}
+
+// the validators the server sent with the cached copy
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func saveCacheMeta(path string, h http.Header) error {
+	data, err := json.Marshal(cacheMeta{ETag: h.Get("ETag"), LastModified: h.Get("Last-Modified")})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".meta", data, 0o644)
+}
+
+func loadCacheMeta(path string) (cacheMeta, error) {
+	var meta cacheMeta
+	data, err := os.ReadFile(path + ".meta")
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// If-Range takes only a strong etag, a weak one falls back to the date
+func (m cacheMeta) ifRange() string {
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// asks the server with a conditional request whether the cached copy at
+// path is still what it serves. a 304 means it is, the body of anything
+// else is left unread
+func cacheFresh(ctx context.Context, cfg *Config, path string) (bool, error) {
+	meta, err := loadCacheMeta(path)
+	if err != nil {
+		return false, err
+	}
+	if meta.ETag == "" && meta.LastModified == "" {
+		return false, errors.New("the server sent no etag or last-modified with the cached copy")
+	}
+
+	req, err := newRequest(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return true, nil
+	case http.StatusOK:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
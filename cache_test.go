@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// the first response is cut off halfway, the retry has to resume it with a
+// range request into the same file a full download would give
+func TestCachedInputResume(t *testing.T) {
+	data := encodeEvents(t, testEvents(2000), FORMAT_ARRAY)
+	var requests atomic.Int32
+	var ranged atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if requests.Add(1) == 1 {
+			// declares the whole length and stops short, the client sees an unexpected eof
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:len(data)/2])
+			return
+		}
+		ranged.Store(r.Header.Get("Range") != "" && r.Header.Get("If-Range") == `"v1"`)
+		http.ServeContent(w, r, "events.json", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Cache = t.TempDir()
+	cfg.Retries = 2
+	path, err := cachedInput(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ranged.Load() {
+		t.Fatal("the retry did not send a range request under the first etag")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("reassembled %d bytes, want the %d served", len(got), len(data))
+	}
+	count, err := decodeStream(context.Background(), bytes.NewReader(got), cfg.ArrayKey, func(*Model) {})
+	if err != nil || count != 2000 {
+		t.Fatalf("decoded %d entries, err %v, want 2000 and no error", count, err)
+	}
+}
+
+// the input changes between the cut off response and the retry, the If-Range
+// makes the server send all of the new one instead of its tail
+func TestCachedInputResumeChanged(t *testing.T) {
+	old := encodeEvents(t, testEvents(2000), FORMAT_ARRAY)
+	data := encodeEvents(t, testEvents(1500), FORMAT_ARRAY)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(old)))
+			w.Write(old[:len(old)/2])
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "events.json", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Cache = t.TempDir()
+	cfg.Retries = 2
+	path, err := cachedInput(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, want the %d of the changed input", len(got), len(data))
+	}
+}
+
+func TestCheckDownloadSize(t *testing.T) {
+	part := filepath.Join(t.TempDir(), "input.part")
+	if err := os.WriteFile(part, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int64{100, -1} {
+		if err := checkDownloadSize(part, size); err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+	}
+	// short, kept so the next attempt resumes it
+	if err := checkDownloadSize(part, 200); err == nil {
+		t.Fatal("a short download passed")
+	}
+	if _, err := os.Stat(part); err != nil {
+		t.Fatalf("short part removed: %v", err)
+	}
+	// too long, thrown away so the next attempt starts over
+	if err := checkDownloadSize(part, 50); err == nil || !strings.Contains(err.Error(), "reported 50") {
+		t.Fatalf("got %v for a long download", err)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Fatalf("long part kept: %v", err)
+	}
+}
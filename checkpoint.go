@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	CHECKPOINT_FILE     = "checkpoint.gob"
+	CHECKPOINT_MAP_FILE = "mapCheckpoint.gob"
+	// entries between looks at the clock
+	CHECKPOINT_CHECK_EVERY = 1024
+)
+
+// the gob payload of a checkpoint artifact, the map or every filter of the
+// pass and how many of its entries they hold
+type Checkpoint struct {
+	Entries int
+	// the bits of a different -hash-seed hold other keys
+	HashSeed uint64
+	Inserts  int
+	Map      map[string]bool
+	Names    []string
+	Filters  [][]byte
+}
+
+// saves the pass's structure every -checkpoint-interval, and on -resume
+// skips the entries the loaded checkpoint already holds. the map pass's is
+// saved once more at its end so a crash in the bloom pass keeps it
+type Checkpointer struct {
+	cfg     *Config
+	mp      *MapProcessor
+	fils    []*Filter
+	pass    string
+	file    string
+	every   time.Duration
+	last    time.Time
+	entries int
+	skip    int
+	saved   int
+}
+
+func NewMapCheckpointer(cfg *Config, mp *MapProcessor) *Checkpointer {
+	return &Checkpointer{cfg: cfg, mp: mp, pass: "map", file: artifactPath(CHECKPOINT_MAP_FILE), every: cfg.Checkpoint, last: time.Now()}
+}
+
+func NewCheckpointer(cfg *Config, fils []*Filter) *Checkpointer {
+	return &Checkpointer{cfg: cfg, fils: fils, pass: "bloom", file: artifactPath(CHECKPOINT_FILE), every: cfg.Checkpoint, last: time.Now()}
+}
+
+// replaces the map or the filters with the checkpoint's. a missing
+// checkpoint starts over, one for other filters, another input or another
+// -hash-seed is refused
+func (c *Checkpointer) Resume() error {
+	hdr, payload, err := LoadArtifact(c.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("no checkpoint to resume, starting over", "file", c.file)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hdr == nil || hdr.Kind != "checkpoint" {
+		return fmt.Errorf("%s is not a checkpoint", c.file)
+	}
+	if src := redactedInput(c.cfg); hdr.Source != src || hdr.Key != c.cfg.Key {
+		return fmt.Errorf("%s is of %s by %s, this run reads %s by %s", c.file, hdr.Source, hdr.Key, src, c.cfg.Key)
+	}
+	var cp Checkpoint
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&cp); err != nil {
+		return fmt.Errorf("%s: %w", c.file, err)
+	}
+	if cp.HashSeed != c.cfg.HashSeed {
+		return fmt.Errorf("%s was saved under -hash-seed %d, this run uses %d", c.file, cp.HashSeed, c.cfg.HashSeed)
+	}
+	if c.mp != nil {
+		c.mp.set, c.mp.inserts, c.mp.keyBytes = cp.Map, cp.Inserts, 0
+		if c.mp.set == nil {
+			c.mp.set = map[string]bool{}
+		}
+		for key := range c.mp.set {
+			c.mp.keyBytes += len(key)
+		}
+		c.skip = cp.Entries
+		slog.Info("resuming checkpoint", "pass", c.pass, "file", c.file, "entries", cp.Entries, "created", hdr.Created)
+		return nil
+	}
+	if len(cp.Names) != len(c.fils) {
+		return fmt.Errorf("%s holds %d filters, -filters builds %d", c.file, len(cp.Names), len(c.fils))
+	}
+	fils := make([]*bloom.BloomFilter, len(c.fils))
+	for i, f := range c.fils {
+		fils[i] = &bloom.BloomFilter{}
+		if err := fils[i].GobDecode(cp.Filters[i]); err != nil {
+			return fmt.Errorf("%s filter %s: %w", c.file, cp.Names[i], err)
+		}
+		if cp.Names[i] != f.name || fils[i].Cap() != f.fil.Cap() || fils[i].K() != f.fil.K() {
+			return fmt.Errorf("%s filter %s m %d k %d does not match %s m %d k %d",
+				c.file, cp.Names[i], fils[i].Cap(), fils[i].K(), f.name, f.fil.Cap(), f.fil.K())
+		}
+	}
+	for i, f := range c.fils {
+		f.fil = fils[i]
+	}
+	c.skip = cp.Entries
+	slog.Info("resuming checkpoint", "pass", c.pass, "file", c.file, "entries", cp.Entries, "created", hdr.Created)
+	return nil
+}
+
+// the skipped entries are still decoded, a json stream cannot be seeked
+func (c *Checkpointer) Wrap(proc func(*Model)) func(*Model) {
+	return func(md *Model) {
+		c.entries += 1
+		if c.entries <= c.skip {
+			// the interval counts from where the checkpoint left off
+			c.last = time.Now()
+			return
+		}
+		proc(md)
+		if c.every > 0 && c.entries%CHECKPOINT_CHECK_EVERY == 0 && time.Since(c.last) >= c.every {
+			if err := c.Save(); err != nil {
+				log.Fatalf("Error saving checkpoint: %v", err)
+			}
+			c.last = time.Now()
+		}
+	}
+}
+
+// written to a temp file and renamed over the last checkpoint, a crash
+// while saving leaves the previous one whole
+func (c *Checkpointer) Save() error {
+	start := time.Now()
+	cp := Checkpoint{Entries: c.entries, HashSeed: c.cfg.HashSeed}
+	if c.mp != nil {
+		cp.Inserts, cp.Map = c.mp.inserts, c.mp.set
+	}
+	for _, f := range c.fils {
+		data, err := f.fil.GobEncode()
+		if err != nil {
+			return err
+		}
+		cp.Names = append(cp.Names, f.name)
+		cp.Filters = append(cp.Filters, data)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cp); err != nil {
+		return err
+	}
+	tmp := c.file + ".tmp"
+	if err := SaveArtifact(tmp, NewArtifactHeader(c.cfg, "checkpoint", 0, c.cfg.FP, c.entries), buf.Bytes()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// on disk before the rename makes it the checkpoint
+	if err := syncFile(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.file); err != nil {
+		return err
+	}
+	// the rename is only on disk once its directory is
+	if err := syncFile(filepath.Dir(c.file)); err != nil {
+		return err
+	}
+	c.saved += 1
+	slog.Info("checkpoint", "pass", c.pass, "file", c.file, "entries", c.entries, "elapsed_us", time.Since(start).Microseconds())
+	return nil
+}
+
+// the run finished, a later -resume has nothing to pick up
+func (c *Checkpointer) Done() {
+	if c.saved == 0 && c.skip == 0 {
+		return
+	}
+	if err := os.Remove(c.file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("could not remove checkpoint", "file", c.file, "err", err)
+		return
+	}
+	slog.Info("pass done, checkpoint removed", "pass", c.pass, "file", c.file, "checkpoints", c.saved, "entries", c.entries)
+}
+
+func syncFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
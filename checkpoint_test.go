@@ -0,0 +1,118 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkpointConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := testConfig("events.json")
+	cfg.N, cfg.FP, cfg.HalfRatio = 100, 0.01, 0.5
+	cfg.Filters = FILTER_BOTH
+	cfg.Checkpoint = time.Hour
+	cfg.OutDir = t.TempDir()
+	saved := outDir
+	t.Cleanup(func() { outDir = saved })
+	if err := setupOutDir(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// a pass cut short after 10 entries and resumed from its checkpoint ends
+// where an uninterrupted one does
+func TestCheckpointResume(t *testing.T) {
+	cfg := checkpointConfig(t)
+	events := testEvents(60)
+
+	whole := NewMapProcessor(cfg.keyFunc, 0)
+	for i := range events {
+		whole.Process(&events[i])
+	}
+
+	mp := NewMapProcessor(cfg.keyFunc, 0)
+	c := NewMapCheckpointer(cfg, mp)
+	proc := c.Wrap(mp.Process)
+	for i := range events[:10] {
+		proc(&events[i])
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.file + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	resumed := NewMapProcessor(cfg.keyFunc, 0)
+	c = NewMapCheckpointer(cfg, resumed)
+	if err := c.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	proc = c.Wrap(resumed.Process)
+	for i := range events {
+		proc(&events[i])
+	}
+	if !maps.Equal(resumed.set, whole.set) || resumed.inserts != whole.inserts || resumed.keyBytes != whole.keyBytes {
+		t.Fatalf("resumed map has %d keys of %d inserts, want %d of %d", len(resumed.set), resumed.inserts, len(whole.set), whole.inserts)
+	}
+
+	fils, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := NewFiltersProcessor(cfg.keyFunc, fils, false)
+	c = NewCheckpointer(cfg, fils)
+	proc = c.Wrap(fp.Process)
+	for i := range events[:10] {
+		proc(&events[i])
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	refilled, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewCheckpointer(cfg, refilled)
+	if err := c.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	proc = c.Wrap(NewFiltersProcessor(cfg.keyFunc, refilled, false).Process)
+	for i := range events {
+		proc(&events[i])
+	}
+	for i := 10; i < len(events); i++ {
+		fp.Process(&events[i])
+	}
+	for i, f := range refilled {
+		if !f.fil.Equal(fils[i].fil) {
+			t.Fatalf("resumed %s differs from the uninterrupted one", f.name)
+		}
+	}
+}
+
+// the bits and the keys of another seed are not this run's
+func TestCheckpointHashSeed(t *testing.T) {
+	cfg := checkpointConfig(t)
+	fils, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCheckpointer(cfg, fils).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewMapCheckpointer(cfg, NewMapProcessor(cfg.keyFunc, 0)).Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.HashSeed = 7
+	for _, c := range []*Checkpointer{NewCheckpointer(cfg, fils), NewMapCheckpointer(cfg, NewMapProcessor(cfg.keyFunc, 0))} {
+		if err := c.Resume(); err == nil || !strings.Contains(err.Error(), "-hash-seed 0") {
+			t.Fatalf("%s pass resumed across seeds, got %v", c.pass, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+)
+
+// fnv-1a over the inserted keys in input order. two runs with different
+// sums did not process the same data, e.g the remote file changed
+type KeyChecksum struct {
+	key KeyFunc
+	h   hash.Hash64
+}
+
+func NewKeyChecksum(key KeyFunc) *KeyChecksum {
+	return &KeyChecksum{key: key, h: fnv.New64a()}
+}
+
+// wraps proc, summing the key of every entry it would insert
+func (c *KeyChecksum) Wrap(proc func(*Model)) func(*Model) {
+	return func(md *Model) {
+		if key, ok := c.key(md); ok {
+			c.h.Write([]byte(key))
+			// separates keys so "ab","c" and "a","bc" differ
+			c.h.Write([]byte{'\n'})
+		}
+		proc(md)
+	}
+}
+
+func (c *KeyChecksum) String() string {
+	return fmt.Sprintf("%016x", c.h.Sum64())
+}
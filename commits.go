@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// overlapping pushes repeat commits, so shas give a second, higher volume
+// key with real duplicates. the map counts them exactly, the bloom by
+// testing before adding, where a false positive turns a new sha into a
+// duplicate
+func RunCommits(ctx context.Context, cfg *Config) {
+	seen := map[string]bool{}
+	fil := bloom.NewWithEstimates(cfg.N, cfg.FP)
+
+	var inserts, mapDups, bloomDups, falseDups int
+	Stage(ctx, "commits", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			if md.Type != "PushEvent" {
+				return
+			}
+			for _, c := range md.Payload.Commits {
+				inserts += 1
+				dup := seen[c.Sha]
+				seen[c.Sha] = true
+				if dup {
+					mapDups += 1
+				}
+				if fil.TestAndAddString(c.Sha) {
+					bloomDups += 1
+					if !dup {
+						falseDups += 1
+					}
+				}
+			}
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+
+	slog.Info(
+		"commit shas",
+		"inserts", inserts,
+		"map_distinct", len(seen),
+		"map_duplicates", mapDups,
+		"bloom_duplicates", bloomDups,
+		"false_duplicates", falseDups,
+		"bloom_approx", fil.ApproximatedSize(),
+		"dup_rate", float64(mapDups)/float64(max(inserts, 1)),
+		"bloom_dup_rate", float64(bloomDups)/float64(max(inserts, 1)),
+	)
+}
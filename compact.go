@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+// go maps never shrink and overshoot while growing, copying into a map
+// sized for exactly the entries left gives the minimal exact set
+func compactMap(m map[string]bool) map[string]bool {
+	compacted := make(map[string]bool, len(m))
+	for k, v := range m {
+		compacted[k] = v
+	}
+	return compacted
+}
+
+// swaps the map pass's set for its compacted copy, measuring the live heap
+// after a collection on either side so the old map is gone in the second
+// reading
+func CompactMapProcessor(p *MapProcessor) {
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	p.set = compactMap(p.set)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	slog.Info(
+		"compact",
+		"mode", "map",
+		"count", len(p.set),
+		"heap_before", humanBytes(before.HeapAlloc),
+		"heap_after", humanBytes(after.HeapAlloc),
+		"saved", humanDelta(after.HeapAlloc, before.HeapAlloc),
+	)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// bloom filters are not safe for concurrent writes
+type SafeBloom struct {
+	mu  sync.Mutex
+	fil *bloom.BloomFilter
+}
+
+func NewSafeBloom(n uint, fp float64) *SafeBloom {
+	return &SafeBloom{fil: bloom.NewWithEstimates(n, fp)}
+}
+
+func (s *SafeBloom) AddString(data string) {
+	s.mu.Lock()
+	s.fil.AddString(data)
+	s.mu.Unlock()
+}
+
+func (s *SafeBloom) TestString(data string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fil.TestString(data)
+}
+
+func ProcessChunkUsingSafeBloom(safe *SafeBloom, key KeyFunc) func(*Model) {
+	return func(md *Model) {
+		if id, ok := key(md); ok {
+			safe.AddString(id)
+		}
+	}
+}
+
+// fans decoded models out to workers over a bounded channel so a fast
+// decoder blocks instead of queueing without limit
+type FanOut struct {
+	ch        chan *Model
+	wg        sync.WaitGroup
+	sent      int
+	stalls    int
+	stallTime time.Duration
+}
+
+// starts one worker per proc
+func NewFanOut(buffer int, procs []func(*Model)) *FanOut {
+	f := &FanOut{ch: make(chan *Model, buffer)}
+	for _, proc := range procs {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			for md := range f.ch {
+				proc(md)
+			}
+		}()
+	}
+	return f
+}
+
+// only the decoding goroutine sends so the counters need no locking
+func (f *FanOut) Send(md *Model) {
+	f.sent += 1
+	select {
+	case f.ch <- md:
+		return
+	default:
+	}
+	start := time.Now()
+	f.ch <- md
+	f.stalls += 1
+	f.stallTime += time.Since(start)
+}
+
+func (f *FanOut) Close() {
+	close(f.ch)
+	f.wg.Wait()
+}
+
+// every worker fills its own filter without locking. all share n and fp so
+// they get the same m and k and can be merged at the end
+func workerBlooms(cfg *Config) ([]*bloom.BloomFilter, []func(*Model)) {
+	fils := make([]*bloom.BloomFilter, cfg.Workers)
+	procs := make([]func(*Model), cfg.Workers)
+	for i := range fils {
+		fil := bloom.NewWithEstimates(cfg.N, cfg.FP)
+		fils[i] = fil
+		procs[i] = func(md *Model) {
+			if id, ok := cfg.keyFunc(md); ok {
+				fil.AddString(id)
+			}
+		}
+	}
+	return fils, procs
+}
+
+func mergeBlooms(fils []*bloom.BloomFilter) *bloom.BloomFilter {
+	merged := fils[0].Copy()
+	for _, fil := range fils[1:] {
+		if err := merged.Merge(fil); err != nil {
+			log.Fatalf("Error merging worker filters: %v", err)
+		}
+	}
+	return merged
+}
+
+func runFanOut(ctx context.Context, cfg *Config, mode string, procs []func(*Model), seen map[string]bool) {
+	var fan *FanOut
+	var elapsed time.Duration
+
+	// workers start inside the stage so they carry its label too
+	Stage(ctx, mode, func(ctx context.Context) {
+		fan = NewFanOut(cfg.Buffer, procs)
+		start := time.Now()
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			if key, ok := cfg.keyFunc(md); ok {
+				seen[key] = true
+			}
+			fan.Send(md)
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+		fan.Close()
+		elapsed = time.Since(start)
+	})
+
+	slog.Info(
+		"concurrent",
+		"mode", mode,
+		"workers", cfg.Workers,
+		"buffer", cfg.Buffer,
+		"count", fan.sent,
+		"elapsed_ms", elapsed.Milliseconds(),
+		"entries_per_sec", float64(fan.sent)/elapsed.Seconds(),
+	)
+	// stalls mean the workers are the bottleneck, not the decoder
+	slog.Info(
+		"reader stalls",
+		"mode", mode,
+		"stalls", fan.stalls,
+		"stall_pct", 100*float64(fan.stalls)/float64(max(fan.sent, 1)),
+		"stall_ms", fan.stallTime.Milliseconds(),
+	)
+}
+
+func RunConcurrent(ctx context.Context, cfg *Config) {
+	seen := map[string]bool{}
+	safe := NewSafeBloom(cfg.N, cfg.FP)
+
+	safeProcs := make([]func(*Model), cfg.Workers)
+	for i := range safeProcs {
+		safeProcs[i] = ProcessChunkUsingSafeBloom(safe, cfg.keyFunc)
+	}
+	runFanOut(ctx, cfg, "safe-bloom", safeProcs, seen)
+
+	fils, procs := workerBlooms(cfg)
+	runFanOut(ctx, cfg, "merged-bloom", procs, seen)
+	var merged *bloom.BloomFilter
+	mergeTime := timeIt(func() {
+		merged = mergeBlooms(fils)
+	})
+
+	slog.Info(
+		"merged",
+		"merge_ms", mergeTime.Milliseconds(),
+		"bloom_approx", merged.ApproximatedSize(),
+		"equals_safe_bloom", merged.Equal(safe.fil),
+		"fp", measureFP(merged, seen, cfg.Negatives),
+	)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	CUCKOO_BUCKET    = 4
+	CUCKOO_MAX_KICKS = 500
+	// fraction of slots a cuckoo filter can fill before inserts start failing
+	CUCKOO_LOAD = 0.95
+)
+
+// a cuckoo filter with 16 bit fingerprints. unlike a bloom it supports
+// deletes, and refuses inserts once full instead of degrading
+type CuckooFilter struct {
+	buckets [][CUCKOO_BUCKET]uint16
+	mask    uint64
+	count   int
+	rng     *rand.Rand
+	// the fingerprint left over when the kicks run out, and its bucket.
+	// while it is held the filter is full
+	victim    uint16
+	victimIdx uint64
+}
+
+func NewCuckooFilter(n uint) *CuckooFilter {
+	want := uint64(float64(n)/CUCKOO_BUCKET/CUCKOO_LOAD) + 1
+	// a power of two so the alternate bucket is an xor away
+	size := uint64(1) << bits.Len64(want-1)
+	return &CuckooFilter{
+		buckets: make([][CUCKOO_BUCKET]uint16, size),
+		mask:    size - 1,
+		rng:     rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// the fingerprint and both candidate buckets of key, 0 marks an empty slot
+func (c *CuckooFilter) locate(key string) (uint16, uint64, uint64) {
+	h := hashKey(key)
+	fp := uint16(h >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	i1 := h & c.mask
+	return fp, i1, c.alt(i1, fp)
+}
+
+// the other bucket of fp, computable from either so evictions can move it
+func (c *CuckooFilter) alt(i uint64, fp uint16) uint64 {
+	return (i ^ mix64(uint64(fp))) & c.mask
+}
+
+func (c *CuckooFilter) put(i uint64, fp uint16) bool {
+	for s, v := range c.buckets[i] {
+		if v == 0 {
+			c.buckets[i][s] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// false once the filter is too full to place key. every key it returned
+// true for stays present
+func (c *CuckooFilter) AddString(key string) bool {
+	if c.victim != 0 {
+		return false
+	}
+	fp, i1, i2 := c.locate(key)
+	if c.put(i1, fp) || c.put(i2, fp) {
+		c.count += 1
+		return true
+	}
+	i := i1
+	if c.rng.IntN(2) == 1 {
+		i = i2
+	}
+	for range CUCKOO_MAX_KICKS {
+		s := c.rng.IntN(CUCKOO_BUCKET)
+		fp, c.buckets[i][s] = c.buckets[i][s], fp
+		i = c.alt(i, fp)
+		if c.put(i, fp) {
+			c.count += 1
+			return true
+		}
+	}
+	// key is placed, the fingerprint it displaced last belongs to an
+	// earlier key and is kept aside rather than dropped
+	c.victim, c.victimIdx = fp, i
+	c.count += 1
+	return true
+}
+
+func (c *CuckooFilter) TestString(key string) bool {
+	fp, i1, i2 := c.locate(key)
+	if c.victim == fp && (c.victimIdx == i1 || c.victimIdx == i2) {
+		return true
+	}
+	for _, v := range c.buckets[i1] {
+		if v == fp {
+			return true
+		}
+	}
+	for _, v := range c.buckets[i2] {
+		if v == fp {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CuckooFilter) Bytes() int {
+	return len(c.buckets) * CUCKOO_BUCKET * 2
+}
+
+type CuckooProcessor struct {
+	key     KeyFunc
+	fil     *CuckooFilter
+	inserts int
+	failed  int
+}
+
+func NewCuckooProcessor(key KeyFunc, n uint) *CuckooProcessor {
+	return &CuckooProcessor{key: key, fil: NewCuckooFilter(n)}
+}
+
+// a cuckoo filter stores a fingerprint per insert, duplicates are tested
+// first so they do not eat its slots
+func (p *CuckooProcessor) Process(md *Model) {
+	key, ok := p.key(md)
+	if !ok {
+		return
+	}
+	p.inserts += 1
+	if p.fil.TestString(key) {
+		return
+	}
+	if !p.fil.AddString(key) {
+		p.failed += 1
+	}
+}
+
+func (p *CuckooProcessor) TestString(key string) bool {
+	return p.fil.TestString(key)
+}
+
+func (p *CuckooProcessor) Report() ProcessorReport {
+	return ProcessorReport{Name: "cuckoo", Inserts: p.inserts, Distinct: uint64(p.fil.count), Bytes: p.fil.Bytes(), Rejected: p.failed}
+}
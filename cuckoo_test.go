@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+// filled well past its load, inserts start failing but no key it accepted
+// may go missing, including the one carried when the kicks ran out
+func TestCuckooNoFalseNegatives(t *testing.T) {
+	c := NewCuckooFilter(1000)
+	var added []string
+	failed := 0
+	for _, key := range syntheticIds(3000, "key-") {
+		if c.AddString(key) {
+			added = append(added, key)
+		} else {
+			failed += 1
+		}
+	}
+	if failed == 0 {
+		t.Fatal("no insert failed, the filter never filled")
+	}
+	if c.victim == 0 {
+		t.Fatal("a full filter holds no victim")
+	}
+	if c.count != len(added) {
+		t.Fatalf("count %d, accepted %d", c.count, len(added))
+	}
+	for _, key := range added {
+		if !c.TestString(key) {
+			t.Fatalf("accepted %q then lost it", key)
+		}
+	}
+}
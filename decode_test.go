@@ -0,0 +1,334 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// n events with ids 0..n-1, every third one a watch event
+func testEvents(n int) []Model {
+	events := make([]Model, n)
+	for i := range events {
+		events[i].Id = fmt.Sprint(i)
+		events[i].Type = "PushEvent"
+		if i%3 == 0 {
+			events[i].Type = "WatchEvent"
+		}
+	}
+	return events
+}
+
+// the events as a json array, an object wrapping it under events, or
+// one per line
+func encodeEvents(t testing.TB, events []Model, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case FORMAT_NDJSON:
+		enc := json.NewEncoder(&buf)
+		for _, md := range events {
+			if err := enc.Encode(md); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	case "object":
+		data, err := json.Marshal(map[string]any{"page": 1, "events": events})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func writeInput(t testing.TB, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testConfig(input string) *Config {
+	cfg := &Config{
+		Input:       input,
+		Key:         "id",
+		Format:      FORMAT_ARRAY,
+		ArrayKey:    "events",
+		LineBuffer:  1 << 20,
+		MaxInMemory: 1 << 30,
+	}
+	setupKey(cfg)
+	return cfg
+}
+
+var readers = map[string]func(context.Context, *Config, ...Processor) error{
+	"ReadAllInMemory":          ReadAllInMemory,
+	"ReadAllInMemoryBuffered":  ReadAllInMemoryBuffered,
+	"ReadAllStreaming":         ReadAllStreaming,
+	"ReadAllStreamingBuffered": ReadAllStreamingBuffered,
+}
+
+// every reader goes through decodeStream or decodeLines, so each has to see
+// every entry of each layout in order
+func TestReaders(t *testing.T) {
+	events := testEvents(500)
+	for _, format := range []string{FORMAT_ARRAY, "object", FORMAT_NDJSON} {
+		input := writeInput(t, "events.json", encodeEvents(t, events, format))
+		for name, read := range readers {
+			t.Run(format+"/"+name, func(t *testing.T) {
+				cfg := testConfig(input)
+				if format == FORMAT_NDJSON {
+					cfg.Format = FORMAT_NDJSON
+				}
+				var ids []string
+				err := read(context.Background(), cfg, ProcessFunc(func(md *Model) {
+					ids = append(ids, md.Id)
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(ids) != len(events) {
+					t.Fatalf("read %d entries, want %d", len(ids), len(events))
+				}
+				for i, id := range ids {
+					if id != events[i].Id {
+						t.Fatalf("entry %d is %s, want %s", i, id, events[i].Id)
+					}
+				}
+			})
+		}
+	}
+}
+
+// an empty input or array holds nothing and is fine, anything else that is
+// not events comes back to the caller as malformed
+func TestReadersMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		data      string
+		malformed bool
+	}{
+		{"empty", "", false},
+		{"whitespace", " \n", false},
+		{"empty array", "[]", false},
+		{"empty object", "{}", true},
+		{"garbage", "not json at all", true},
+		{"number", "42", true},
+	} {
+		input := writeInput(t, "events.json", []byte(tc.data))
+		for name, read := range readers {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				count := 0
+				err := read(context.Background(), testConfig(input), ProcessFunc(func(*Model) { count += 1 }))
+				if count != 0 {
+					t.Fatalf("processed %d entries", count)
+				}
+				if got := errors.Is(err, errMalformed); got != tc.malformed {
+					t.Fatalf("got %v, malformed %v", err, tc.malformed)
+				}
+				if !tc.malformed && err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	events := testEvents(50)
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		arrayKey string
+		want     int
+	}{
+		{"array", encodeEvents(t, events, FORMAT_ARRAY), "events", 50},
+		{"object", encodeEvents(t, events, "object"), "events", 50},
+		{"other key", []byte(`{"items": [{"id": "1"}, {"id": "2"}]}`), "items", 2},
+		{"fields after the array", []byte(`{"events": [{"id": "1"}], "next": "x"}`), "events", 1},
+		{"badly typed entry skipped", []byte(`[{"id": "1"}, {"id": 2}, {"id": "3"}]`), "events", 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			count, err := decodeStream(context.Background(), bytes.NewReader(tc.data), tc.arrayKey, func(*Model) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tc.want {
+				t.Fatalf("decoded %d entries, want %d", count, tc.want)
+			}
+		})
+	}
+}
+
+// the whole input is already buffered, so only the per entry check can stop
+// the loop. it has to stop at the entry after the cancel, not at the end
+func TestDecodeCancel(t *testing.T) {
+	events := testEvents(20000)
+	for _, format := range []string{FORMAT_ARRAY, FORMAT_NDJSON} {
+		t.Run(format, func(t *testing.T) {
+			data := encodeEvents(t, events, format)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			seen := 0
+			proc := func(*Model) {
+				if seen += 1; seen == 100 {
+					cancel()
+				}
+			}
+			var count int
+			var err error
+			if format == FORMAT_NDJSON {
+				count, err = decodeLines(ctx, bytes.NewReader(data), 1<<20, proc)
+			} else {
+				count, err = decodeStream(ctx, bytes.NewReader(data), "events", proc)
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want context.Canceled", err)
+			}
+			if count != 100 || seen != 100 {
+				t.Fatalf("decoded %d entries and processed %d after cancelling at 100", count, seen)
+			}
+		})
+	}
+}
+
+// a cut anywhere past the opening bracket is a truncation, garbage with
+// input after it is not, whichever -json-impl decodes it
+func TestDecodeTruncated(t *testing.T) {
+	for _, name := range tokenizerNames() {
+		t.Run(name, func(t *testing.T) {
+			saved := NewTokenizer
+			defer func() { NewTokenizer = saved }()
+			NewTokenizer = tokenizers[name]
+
+			data := encodeEvents(t, testEvents(3), FORMAT_ARRAY)
+			for cut := 1; cut < len(data); cut++ {
+				_, err := decodeStream(context.Background(), bytes.NewReader(data[:cut]), "events", func(*Model) {})
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("cut at %d of %d %q: got %v, want io.ErrUnexpectedEOF", cut, len(data), data[max(cut-10, 0):cut], err)
+				}
+			}
+			for _, garbage := range []string{`[{"id": "1"}, x {"id": "2"}]`, `[{"id": "1"}, {"id" x`, `[{"id": "1"} "2"]`} {
+				_, err := decodeStream(context.Background(), strings.NewReader(garbage), "events", func(*Model) {})
+				if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("%s: got %v, want a syntax error", garbage, err)
+				}
+			}
+
+			lines := encodeEvents(t, testEvents(3), FORMAT_NDJSON)
+			for cut := 1; cut < len(lines); cut++ {
+				count, err := decodeLines(context.Background(), bytes.NewReader(lines[:cut]), 1<<20, func(*Model) {})
+				// a last line missing only its newline is complete
+				if lines[cut-1] == '\n' || lines[cut] == '\n' {
+					if err != nil {
+						t.Fatalf("cut after line %d: %v", count, err)
+					}
+					continue
+				}
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("ndjson cut at %d of %d %q: got %v, want io.ErrUnexpectedEOF", cut, len(lines), lines[max(cut-10, 0):cut], err)
+				}
+			}
+			// cut short with lines after it is a broken line, not the end
+			_, err := decodeLines(context.Background(), strings.NewReader("{\"id\": \"1\"}\n{\"id\": \n{\"id\": \"3\"}\n"), 1<<20, func(*Model) {})
+			if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("broken middle line: got %v, want a syntax error", err)
+			}
+		})
+	}
+}
+
+// one pass feeds every processor each entry
+func TestReadersDriveProcessors(t *testing.T) {
+	cfg := testConfig(writeInput(t, "events.json", encodeEvents(t, testEvents(30), FORMAT_ARRAY)))
+	mp := NewMapProcessor(cfg.keyFunc, 0)
+	seen := 0
+	count := ProcessFunc(func(*Model) { seen += 1 })
+	if err := ReadAllStreaming(context.Background(), cfg, mp, count); err != nil {
+		t.Fatal(err)
+	}
+	if seen != 30 || len(mp.set) != 20 || mp.Duplicates() != 0 {
+		t.Fatalf("counted %d entries and mapped %d keys, want 30 and 20", seen, len(mp.set))
+	}
+}
+
+// members as name and content, written in order
+func tarMembers(t *testing.T, members [][2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		if err := tw.WriteHeader(&tar.Header{Name: m[0], Mode: 0o644, Size: int64(len(m[1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(m[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// every json and ndjson member in archive order, gzipped or not, anything
+// else skipped
+func TestDecodeTar(t *testing.T) {
+	cfg := testConfig("events.tar")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(encodeEvents(t, testEvents(5), FORMAT_NDJSON))
+	zw.Close()
+	data := tarMembers(t, [][2]string{
+		{"a.json", string(encodeEvents(t, testEvents(10), FORMAT_ARRAY))},
+		{"README.md", "not json"},
+		{"b.ndjson", string(encodeEvents(t, testEvents(20), FORMAT_NDJSON))},
+		{"c.jsonl.gz", gz.String()},
+	})
+
+	var ids []string
+	count, err := decodeTar(context.Background(), cfg, bytes.NewReader(data), func(md *Model) { ids = append(ids, md.Id) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 35 || len(ids) != 35 {
+		t.Fatalf("decoded %d entries, processed %d, want 35", count, len(ids))
+	}
+	// b.ndjson starts over at 0 after a.json's last
+	if ids[9] != "9" || ids[10] != "0" || ids[30] != "0" {
+		t.Fatalf("members out of order: %q", ids)
+	}
+
+	// cut inside b.ndjson, a.json's entries are kept and the error says where
+	cut := bytes.Index(data, []byte(`"id":"15"`))
+	if cut < 0 {
+		t.Fatal("b.ndjson not found in the archive")
+	}
+	count, err = decodeTar(context.Background(), cfg, bytes.NewReader(data[:cut]), func(*Model) {})
+	if err == nil || !strings.Contains(err.Error(), "b.ndjson") {
+		t.Fatalf("got %v for a truncated archive, want an error naming b.ndjson", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	if count < 10 {
+		t.Fatalf("kept %d entries before the cut, want at least a.json's 10", count)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// dedups a new batch against a bloom saved by a previous run. a false
+// positive marks a new id as seen so the new count can only be an under count
+func RunOnlyNew(ctx context.Context, cfg *Config) {
+	if _, _, err := onlyNew(ctx, cfg); err != nil {
+		log.Fatalf("Error in -only-new: %v", err)
+	}
+}
+
+// the baseline's keys went through the -hash-seed it was saved with, this
+// batch's go through the same one whatever this run's is
+func onlyNew(ctx context.Context, cfg *Config) (newCount, seenCount int, err error) {
+	hdr, data, err := LoadArtifact(cfg.OnlyNew)
+	if err != nil {
+		return 0, 0, fmt.Errorf("loading baseline: %w", err)
+	}
+	baseline := &bloom.BloomFilter{}
+	if err := baseline.GobDecode(data); err != nil {
+		return 0, 0, fmt.Errorf("decoding baseline: %w", err)
+	}
+	if hdr != nil && hdr.Key != "" && hdr.Key != cfg.Key {
+		slog.Warn("baseline was built from another key", "baseline_key", hdr.Key, "key", cfg.Key)
+	}
+	seed := cfg.HashSeed
+	if hdr != nil && hdr.HashSeed != seed {
+		slog.Warn("baseline was built under another -hash-seed, using its", "baseline_hash_seed", hdr.HashSeed, "hash_seed", seed)
+		seed = hdr.HashSeed
+	}
+	hashKey := seededKey(seed)
+	slog.Info("baseline", "file", cfg.OnlyNew, "bloom_approx", baseline.ApproximatedSize(), "bloom_bytes", baseline.BitSet().BinaryStorageSize())
+
+	if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+		key, ok := cfg.keyFunc(md)
+		if !ok {
+			return
+		}
+		if baseline.TestString(hashKey(key)) {
+			seenCount += 1
+			return
+		}
+		slog.Debug("new key", "key", key)
+		baseline.AddString(hashKey(key))
+		newCount += 1
+	})); err != nil {
+		return 0, 0, fmt.Errorf("reading input: %w", err)
+	}
+
+	slog.Info("only new", "new", newCount, "seen", seenCount, "bloom_approx", baseline.ApproximatedSize())
+
+	// the updated filter becomes the baseline for the next batch
+	blomBytes, err := baseline.GobEncode()
+	if err != nil {
+		return 0, 0, fmt.Errorf("encoding baseline: %w", err)
+	}
+	n, fp := cfg.N, cfg.FP
+	if hdr != nil {
+		n, fp = hdr.N, hdr.FP
+	}
+	entries := int(baseline.ApproximatedSize())
+	out := NewArtifactHeader(cfg, "bloom", n, fp, entries)
+	out.HashSeed = seed
+	// the filter holds every batch so far, not just this input
+	if hdr != nil && hdr.Source != "" && !slices.Contains(strings.Split(hdr.Source, ","), out.Source) {
+		out.Source = hdr.Source + "," + out.Source
+	}
+	if err := SaveArtifact(cfg.OnlyNew, out, blomBytes); err != nil {
+		return 0, 0, fmt.Errorf("saving baseline: %w", err)
+	}
+	return newCount, seenCount, nil
+}
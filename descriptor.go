@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	DESCRIPTOR_FORMAT = "bvm-bloom-v1"
+	// inserted keys carried along so a reader can check its hashing
+	DESCRIPTOR_SAMPLES = 8
+)
+
+// a filter as json for readers in other languages.
+//
+// bits_base64 is standard base64 of ceil(m/8) bytes, bit i of the filter is
+// (byte[i/8] >> (i%8)) & 1, least significant bit first. these are the
+// bitset's uint64 words written little endian with the unused tail cut off.
+//
+// a key's k locations, as in bits-and-blooms/bloom v3, over its utf-8 bytes:
+//
+//	h0, h1 = murmur3 x64 128 of key, seed 0, as two uint64 halves
+//	h2, h3 = murmur3 x64 128 of key followed by the byte 0x01
+//	loc(i) = (h[i%2] + i*h[2+((i+i%2)%4)/2]) mod 2^64 mod m, i in 0..k-1
+//
+// the key is present when all k bits are set. under -hash-seed the keys,
+// present included, are the 16 hex digits of xxhash64(seed, key)
+type BloomDescriptor struct {
+	Format  string   `json:"format"`
+	M       uint64   `json:"m"`
+	K       uint64   `json:"k"`
+	Bits    string   `json:"bits_base64"`
+	Present []string `json:"present"`
+}
+
+func NewBloomDescriptor(f *bloom.BloomFilter, keys []string) *BloomDescriptor {
+	m := uint64(f.Cap())
+	buf := make([]byte, 0, len(f.BitSet().Bytes())*8)
+	for _, w := range f.BitSet().Bytes() {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	// sorted so the same filter always writes the same samples
+	present := append([]string(nil), keys...)
+	sort.Strings(present)
+	return &BloomDescriptor{
+		Format:  DESCRIPTOR_FORMAT,
+		M:       m,
+		K:       uint64(f.K()),
+		Bits:    base64.StdEncoding.EncodeToString(buf[:(m+7)/8]),
+		Present: present[:min(len(present), DESCRIPTOR_SAMPLES)],
+	}
+}
+
+// rebuilds the filter, failing unless it holds every sample
+func (d *BloomDescriptor) Filter() (*bloom.BloomFilter, error) {
+	if d.Format != DESCRIPTOR_FORMAT {
+		return nil, fmt.Errorf("format %q, want %q", d.Format, DESCRIPTOR_FORMAT)
+	}
+	if d.M == 0 || d.K == 0 {
+		return nil, fmt.Errorf("m %d and k %d must be positive", d.M, d.K)
+	}
+	raw, err := base64.StdEncoding.DecodeString(d.Bits)
+	if err != nil {
+		return nil, fmt.Errorf("bits_base64: %w", err)
+	}
+	if uint64(len(raw)) != (d.M+7)/8 {
+		return nil, fmt.Errorf("%d bytes of bits, m %d needs %d", len(raw), d.M, (d.M+7)/8)
+	}
+	words := make([]uint64, (d.M+63)/64)
+	padded := append(raw, make([]byte, len(words)*8-len(raw))...)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(padded[i*8:])
+	}
+	if tail := d.M % 64; tail != 0 && words[len(words)-1]>>tail != 0 {
+		return nil, fmt.Errorf("bits set past m %d", d.M)
+	}
+	// FromWithM would size the bit set to the words rather than m, and
+	// filters only compare equal when the lengths match
+	f := bloom.New(uint(d.M), uint(d.K))
+	copy(f.BitSet().Bytes(), words)
+	for _, key := range d.Present {
+		if !f.TestString(key) {
+			return nil, fmt.Errorf("sample %q tests absent", key)
+		}
+	}
+	return f, nil
+}
+
+func SaveDescriptor(filename string, d *BloomDescriptor) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+func LoadDescriptor(filename string) (*bloom.BloomFilter, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var d BloomDescriptor
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	f, err := d.Filter()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return f, nil
+}
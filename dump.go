@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"sort"
+)
+
+// writes every map key, one per line and sorted so dumps of the same input
+// diff cleanly. this is the ground truth a loaded bloom can be replayed against
+func DumpIds(filename string, m map[string]bool) error {
+	keys := keysOf(m)
+	sort.Strings(keys)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, k := range keys {
+		w.WriteString(k)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
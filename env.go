@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const ENV_PREFIX = "BVM_"
+
+// variables not derived from their flag's name, -n and -fp alone say
+// nothing in an environment shared with other tools
+var envNames = map[string]string{
+	"n":  ENV_PREFIX + "BLOOM_N",
+	"fp": ENV_PREFIX + "BLOOM_FP",
+}
+
+// the variable standing in for a flag e.g -max-duration is BVM_MAX_DURATION
+func envName(flagName string) string {
+	if name, ok := envNames[flagName]; ok {
+		return name
+	}
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// sets every flag left off the command line from its variable, so an
+// explicit flag wins over the environment which wins over the default.
+// flags set here count as set for flag.Visit like explicit ones
+func applyEnv() error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if e := flag.Set(f.Name, v); e != nil {
+			err = fmt.Errorf("%s=%q: %w", envName(f.Name), v, e)
+		}
+	})
+	return err
+}
+
+// whether some flag has its variable set
+func envSet() bool {
+	set := false
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := os.LookupEnv(envName(f.Name)); ok {
+			set = true
+		}
+	})
+	return set
+}
+
+func envUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nEvery flag can also be set from %sNAME, the flag name upper cased with - as _\n", ENV_PREFIX)
+	fmt.Fprintf(out, "e.g %s, %s, except %s and %s for -n and -fp.\n", envName("input"), envName("outdir"), envName("n"), envName("fp"))
+	fmt.Fprintf(out, "an explicit flag wins over the variable, the variable over the default\n")
+	fmt.Fprintf(out, "\nRun without arguments or variables to list the subcommands, each taking part of these flags\n")
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestEnvName(t *testing.T) {
+	for flagName, want := range map[string]string{
+		"input":        "BVM_INPUT",
+		"max-duration": "BVM_MAX_DURATION",
+		"outdir":       "BVM_OUTDIR",
+		"n":            "BVM_BLOOM_N",
+		"fp":           "BVM_BLOOM_FP",
+	} {
+		if got := envName(flagName); got != want {
+			t.Errorf("-%s: got %s, want %s", flagName, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// prints how -n and -fp turn into m and k, and what the half filter shows
+func Explain(w io.Writer, cfg *Config) {
+	n, p := float64(cfg.N), cfg.FP
+	m, k := bloom.EstimateParameters(cfg.N, cfg.FP)
+
+	fmt.Fprintf(w, "sizing a bloom filter for n = %d entries at a false positive rate p = %g\n\n", cfg.N, p)
+	fmt.Fprintf(w, "bits      m = ceil(-n ln(p) / ln(2)^2)\n")
+	fmt.Fprintf(w, "            = ceil(-%g * %.4f / %.4f) = %d\n", n, math.Log(p), math.Ln2*math.Ln2, m)
+	fmt.Fprintf(w, "hashes    k = ceil(m / n * ln(2))\n")
+	fmt.Fprintf(w, "            = ceil(%d / %g * %.4f) = %d\n", m, n, math.Ln2, k)
+	fmt.Fprintf(w, "memory      = m / 8 = %s, %.2f bits per entry\n", humanBytes(uint64((m+7)/8)), float64(m)/n)
+	fmt.Fprintf(w, "fp at n     = (1 - e^(-k n / m))^k = %.6f\n\n", fpFor(m, k, int(cfg.N)))
+
+	hn := uint(n * cfg.HalfRatio)
+	hm, hk := bloom.EstimateParameters(hn, cfg.FP)
+	fmt.Fprintf(w, "the half filter is sized for %d entries (-half-ratio %g) with m = %d, k = %d\n", hn, cfg.HalfRatio, hm, hk)
+	fmt.Fprintf(w, "holding the %d it was sized for its fp is %.6f, but fed all n = %d it is\n", hn, fpFor(hm, hk, int(hn)), cfg.N)
+	fmt.Fprintf(w, "(1 - e^(-%d * %d / %d))^%d = %.6f\n", hk, cfg.N, hm, hk, fpFor(hm, hk, int(cfg.N)))
+	fmt.Fprintf(w, "a filter never refuses an insert, past capacity more bits are set and the\n")
+	fmt.Fprintf(w, "false positive rate climbs towards 1 while the memory stays the same\n")
+}
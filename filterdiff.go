@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"math/bits"
+	"strings"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// bits set in one filter and not the other. filters of different m or k
+// hash keys to different places so there is nothing to count
+func diffBits(a, b *bloom.BloomFilter) (int, error) {
+	if a.Cap() != b.Cap() || a.K() != b.K() {
+		return 0, fmt.Errorf("m %d k %d against m %d k %d", a.Cap(), a.K(), b.Cap(), b.K())
+	}
+	diff := 0
+	wa, wb := a.BitSet().Bytes(), b.BitSet().Bytes()
+	for i := range wa {
+		diff += bits.OnesCount64(wa[i] ^ wb[i])
+	}
+	return diff, nil
+}
+
+// loads the two saved filters of -diff-filters and fails unless their bit
+// sets are identical, e.g two runs over the same input with the same seed
+func RunDiffFilters(cfg *Config) {
+	files := strings.Split(cfg.DiffFilters, ",")
+	fils := make([]*bloom.BloomFilter, len(files))
+	hdrs := make([]*ArtifactHeader, len(files))
+	for i, file := range files {
+		hdr, payload, err := LoadArtifact(file)
+		if err != nil {
+			log.Fatalf("Error loading bloom artifact: %v", err)
+		}
+		fils[i], hdrs[i] = &bloom.BloomFilter{}, hdr
+		if err := fils[i].GobDecode(payload); err != nil {
+			log.Fatalf("Error decoding %s: %v", file, err)
+		}
+	}
+	// the same keys land on other bits under another seed
+	if err := sameSeed(hdrs[0], hdrs[1]); err != nil {
+		log.Fatalf("Error comparing %s and %s: %v", files[0], files[1], err)
+	}
+	diff, err := diffBits(fils[0], fils[1])
+	if err != nil {
+		log.Fatalf("Error comparing %s and %s: %v", files[0], files[1], err)
+	}
+	slog.Info(
+		"filter diff",
+		"a", files[0],
+		"b", files[1],
+		"m", fils[0].Cap(),
+		"k", fils[0].K(),
+		"a_bits_set", fils[0].BitSet().Count(),
+		"b_bits_set", fils[1].BitSet().Count(),
+		"differing_bits", diff,
+		"differing_pct", 100*float64(diff)/float64(fils[0].Cap()),
+		"equal", fils[0].Equal(fils[1]),
+	)
+	if diff > 0 {
+		log.Fatalf("%s and %s differ in %d bits", files[0], files[1], diff)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+const (
+	FILTER_FULL = "full"
+	FILTER_HALF = "half"
+	FILTER_BOTH = "both"
+)
+
+// one of the blooms filled by the compare run, sized for n entries
+type Filter struct {
+	name string
+	n    uint
+	fil  *bloom.BloomFilter
+	// keys already present when -bloom-pretest tested them
+	pretestHits int
+	// GobEncode and Save of its artifact
+	encode, save time.Duration
+}
+
+// spec is full, half, both or a comma separated mix of those and
+// capacities e.g full,3000,24000. half is -half-ratio of -n, or of -bloom-m
+// when m and k are pinned
+func newFilters(cfg *Config) ([]*Filter, error) {
+	spec := cfg.Filters
+	if spec == FILTER_BOTH {
+		spec = FILTER_FULL + "," + FILTER_HALF
+	}
+
+	var fils []*Filter
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		f := &Filter{name: part}
+		// pinned m and k stand in for the estimates of full and half
+		var m, k uint
+		switch part {
+		case FILTER_FULL:
+			f.n = cfg.N
+			m, k = cfg.BloomM, cfg.BloomK
+		case FILTER_HALF:
+			f.n = uint(float64(cfg.N) * cfg.HalfRatio)
+			m, k = uint(float64(cfg.BloomM)*cfg.HalfRatio), cfg.BloomK
+		default:
+			n, err := strconv.ParseUint(part, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("filter %q is not %s, %s, %s or a capacity", part, FILTER_FULL, FILTER_HALF, FILTER_BOTH)
+			}
+			f.name, f.n = fmt.Sprintf("n%d", n), uint(n)
+		}
+		if f.n == 0 {
+			return nil, fmt.Errorf("filter %q has no capacity", part)
+		}
+		if seen[f.name] {
+			return nil, fmt.Errorf("filter %q listed twice", part)
+		}
+		seen[f.name] = true
+		if m > 0 && k > 0 {
+			f.fil = bloom.New(m, k)
+		} else {
+			f.fil = bloom.NewWithEstimates(f.n, cfg.FP)
+		}
+		fils = append(fils, f)
+	}
+	return fils, nil
+}
+
+// full keeps the original artifact name, the others are prefixed with theirs
+func (f *Filter) File() string {
+	if f.name == FILTER_FULL {
+		return artifactPath("bloomBytes.gob")
+	}
+	return artifactPath(f.name + "bloomBytes.gob")
+}
+
+// its bit set without the gob wrapper, see rawbits.go
+func (f *Filter) RawFile() string {
+	if f.name == FILTER_FULL {
+		return artifactPath("bloomBytes.bin")
+	}
+	return artifactPath(f.name + "bloomBytes.bin")
+}
+
+// adds each key to every filter. with pretest it tests first so the filter
+// also counts what it takes for duplicates
+type FiltersProcessor struct {
+	key     KeyFunc
+	fils    []*Filter
+	pretest bool
+	inserts int
+}
+
+func NewFiltersProcessor(key KeyFunc, fils []*Filter, pretest bool) *FiltersProcessor {
+	return &FiltersProcessor{key: key, fils: fils, pretest: pretest}
+}
+
+func (p *FiltersProcessor) Process(md *Model) {
+	key, ok := p.key(md)
+	if !ok {
+		return
+	}
+	p.inserts += 1
+	for _, f := range p.fils {
+		if p.pretest && f.TestString(key) {
+			f.pretestHits += 1
+			continue
+		}
+		f.AddString(key)
+	}
+}
+
+func (p *FiltersProcessor) Report() ProcessorReport {
+	report := ProcessorReport{Name: "filters", Inserts: p.inserts, Bytes: filterBytes(p.fils)}
+	if len(p.fils) > 0 {
+		report.Distinct = uint64(p.fils[0].fil.ApproximatedSize())
+	}
+	return report
+}
+
+// a bloom as a dedup set: what tested present was a duplicate. true
+// duplicates always test present, so everything past the map's exact count
+// is a new key the filter collided on and would have dropped
+func reportPretest(fils []*Filter, duplicates, distinct int) {
+	for _, f := range fils {
+		falseDups := f.pretestHits - duplicates
+		slog.Info(
+			"pretest",
+			"filter", f.name,
+			"approx_duplicates", f.pretestHits,
+			"exact_duplicates", duplicates,
+			"false_duplicates", falseDups,
+			"false_duplicate_rate", float64(falseDups)/float64(max(distinct, 1)),
+		)
+	}
+}
+
+func filterBytes(fils []*Filter) int {
+	total := 0
+	for _, f := range fils {
+		total += f.fil.BitSet().BinaryStorageSize()
+	}
+	return total
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+type FalsePositiveReport struct {
+	Tested          int     `json:"tested"`
+	Positives       int     `json:"positives"`
+	MeasuredRate    float64 `json:"measured_rate"`
+	TheoreticalRate float64 `json:"theoretical_rate"`
+}
+
+func (r FalsePositiveReport) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("tested", r.Tested),
+		slog.Int("positives", r.Positives),
+		slog.Float64("measured_rate", r.MeasuredRate),
+		slog.Float64("theoretical_rate", r.TheoreticalRate),
+	)
+}
+
+// sequential synthetic ids checked against the map so every one is a true
+// negative. the same n always yields the same set across runs
+func NegativeIds[V any](present map[string]V, n int) []string {
+	ids := make([]string, 0, n)
+	for i := 0; len(ids) < n; i++ {
+		id := fmt.Sprintf("negative-%d", i)
+		if _, ok := present[id]; ok {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// (1 - e^(-kn/m))^k for a filter of m bits and k hashes holding n elements
+func fpFor(m, k uint, n int) float64 {
+	return math.Pow(1-math.Exp(-float64(k)*float64(n)/float64(m)), float64(k))
+}
+
+func theoreticalFP(f *bloom.BloomFilter, n int) float64 {
+	return fpFor(f.Cap(), f.K(), n)
+}
+
+// tests f against negatives known to be absent from present, the exact set
+// that was inserted into f
+func measureFP[V any](f *bloom.BloomFilter, present map[string]V, negatives int) FalsePositiveReport {
+	return fpReport(f, len(present), NegativeIds(present, negatives))
+}
+
+// tests ids, none of them inserted, against f holding n keys
+func fpReport(f *bloom.BloomFilter, n int, ids []string) FalsePositiveReport {
+	positives := TestMany(f, ids)
+	report := FalsePositiveReport{
+		Tested:          len(ids),
+		Positives:       positives,
+		TheoreticalRate: theoreticalFP(f, n),
+	}
+	if len(ids) > 0 {
+		report.MeasuredRate = float64(positives) / float64(len(ids))
+	}
+	return report
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// over enough negatives the measured rate is a tight binomial estimate of
+// the formula, the library's double hashing runs a few percent over it
+func TestMeasureFPConverges(t *testing.T) {
+	const negatives = 200000
+	for _, tc := range []struct {
+		n    uint
+		fp   float64
+		fill float64
+	}{
+		{12000, 0.1, 1},
+		{12000, 0.01, 1},
+		{5000, 0.05, 0.5},
+		// over-filled, the rate is far past what the filter was sized for
+		{6000, 0.1, 2},
+	} {
+		fil := bloom.NewWithEstimates(tc.n, tc.fp)
+		present := map[string]bool{}
+		for _, id := range syntheticIds(int(tc.fill*float64(tc.n)), "id-") {
+			fil.AddString(id)
+			present[id] = true
+		}
+		report := measureFP(fil, present, negatives)
+
+		if report.Tested != negatives {
+			t.Fatalf("n=%d fp=%g: tested %d, want %d", tc.n, tc.fp, report.Tested, negatives)
+		}
+		want := report.TheoreticalRate
+		if want != theoreticalFP(fil, len(present)) {
+			t.Fatalf("n=%d fp=%g: theoretical rate %g, want %g", tc.n, tc.fp, want, theoreticalFP(fil, len(present)))
+		}
+		sigma := math.Sqrt(want * (1 - want) / negatives)
+		if diff := math.Abs(report.MeasuredRate - want); diff > 0.1*want+4*sigma {
+			t.Errorf("n=%d fp=%g fill=%g: measured %.5f, theoretical %.5f", tc.n, tc.fp, tc.fill, report.MeasuredRate, want)
+		}
+	}
+}
+
+func TestNegativeIds(t *testing.T) {
+	present := map[string]bool{"negative-0": true, "negative-2": true}
+	ids := NegativeIds(present, 3)
+	if want := []string{"negative-1", "negative-3", "negative-4"}; !slices.Equal(ids, want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	if again := NegativeIds(present, 3); !slices.Equal(ids, again) {
+		t.Fatalf("not repeatable: %v then %v", ids, again)
+	}
+}
+
+func TestFPReportNoIds(t *testing.T) {
+	report := fpReport(bloom.NewWithEstimates(100, 0.1), 0, nil)
+	if report.Tested != 0 || report.MeasuredRate != 0 {
+		t.Fatalf("got %+v for no ids", report)
+	}
+}
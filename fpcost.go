@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// fp rates swept by -fp-cost
+var fpCostRates = []float64{0.5, 0.2, 0.1, 0.05, 0.01, 0.001, 0.0001}
+
+// a bloom in front of an expensive exact check, e.g a database. every
+// positive pays for the check, the false ones for nothing. the check is
+// a real map lookup plus -fp-cost added per call rather than slept, so the
+// sweep stays fast while the totals show where a lower fp stops paying off
+func RunFPCost(ctx context.Context, cfg *Config) {
+	ids := collectIds(ctx, cfg)
+	exact := map[string]bool{}
+	for _, id := range ids {
+		exact[id] = true
+	}
+	queries := append(keysOf(exact), NegativeIds(exact, cfg.Negatives)...)
+
+	best, bestTotal := 0.0, time.Duration(-1)
+	for _, fp := range fpCostRates {
+		fil := bloom.NewWithEstimates(uint(len(exact)), fp)
+		for id := range exact {
+			fil.AddString(id)
+		}
+
+		var checks, wasted int
+		elapsed := timeIt(func() {
+			for _, q := range queries {
+				if !fil.TestString(q) {
+					continue
+				}
+				checks += 1
+				if !exact[q] {
+					wasted += 1
+				}
+			}
+		})
+		total := elapsed + time.Duration(checks)*cfg.FPCost
+		if bestTotal < 0 || total < bestTotal {
+			best, bestTotal = fp, total
+		}
+		slog.Info(
+			"fp cost",
+			"fp", fp,
+			"k", fil.K(),
+			"bloom_bytes", fil.BitSet().BinaryStorageSize(),
+			"queries", len(queries),
+			"checks", checks,
+			"wasted_checks", wasted,
+			"wasted_ms", (time.Duration(wasted) * cfg.FPCost).Milliseconds(),
+			"lookup_ms", elapsed.Milliseconds(),
+			"total_ms", total.Milliseconds(),
+		)
+	}
+	slog.Info("fp cost optimum", "fp", best, "total_ms", bestTotal.Milliseconds(), "check_cost", cfg.FPCost)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// one hour of public github events, newline delimited json gzipped
+const GHARCHIVE_URL = "https://data.gharchive.org/%s.json.gz"
+
+// at most a month of hours per run, a typo in a year should not queue
+// thousands of downloads
+const GHARCHIVE_MAX_HOURS = 31 * 24
+
+// YYYY-MM-DD-H, the hour with or without a leading zero
+func parseGHArchiveHour(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndex(s, "-")
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("%q is not YYYY-MM-DD-H e.g 2015-01-01-15", s)
+	}
+	day, hour := s[:i], s[i+1:]
+	t, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not YYYY-MM-DD-H e.g 2015-01-01-15: %v", s, err)
+	}
+	h, err := strconv.Atoi(hour)
+	if err != nil || h < 0 || h > 23 {
+		return time.Time{}, fmt.Errorf("%q has hour %q, want 0 to 23", s, hour)
+	}
+	return t.Add(time.Duration(h) * time.Hour), nil
+}
+
+// archive names drop the hour's leading zero e.g 2015-01-01-5
+func ghArchiveURL(t time.Time) string {
+	return fmt.Sprintf(GHARCHIVE_URL, t.Format("2006-01-02")+"-"+strconv.Itoa(t.Hour()))
+}
+
+// spec is one hour or an inclusive FROM..TO range of hours
+func ghArchiveURLs(spec string) ([]string, error) {
+	from, to, isRange := strings.Cut(spec, "..")
+	start, err := parseGHArchiveHour(from)
+	if err != nil {
+		return nil, err
+	}
+	end := start
+	if isRange {
+		if end, err = parseGHArchiveHour(to); err != nil {
+			return nil, err
+		}
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("range %q ends before it starts", spec)
+	}
+	if hours := int(end.Sub(start)/time.Hour) + 1; hours > GHARCHIVE_MAX_HOURS {
+		return nil, fmt.Errorf("range %q covers %d hours, at most %d per run", spec, hours, GHARCHIVE_MAX_HOURS)
+	}
+
+	var urls []string
+	for t := start; !t.After(end); t = t.Add(time.Hour) {
+		urls = append(urls, ghArchiveURL(t))
+	}
+	return urls, nil
+}
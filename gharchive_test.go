@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGHArchiveURLs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec string
+		want []string
+		err  string
+	}{
+		{"one hour", "2015-01-01-15", []string{"https://data.gharchive.org/2015-01-01-15.json.gz"}, ""},
+		{"leading zero dropped", "2015-01-01-05", []string{"https://data.gharchive.org/2015-01-01-5.json.gz"}, ""},
+		{"range over midnight", "2015-01-01-22..2015-01-02-1", []string{
+			"https://data.gharchive.org/2015-01-01-22.json.gz",
+			"https://data.gharchive.org/2015-01-01-23.json.gz",
+			"https://data.gharchive.org/2015-01-02-0.json.gz",
+			"https://data.gharchive.org/2015-01-02-1.json.gz",
+		}, ""},
+		{"bad date", "2015-13-01-5", nil, "is not YYYY-MM-DD-H"},
+		{"no hour", "2015-01-01", nil, "is not YYYY-MM-DD-H"},
+		{"hour not a number", "2015-01-01-x", nil, "has hour"},
+		{"hour out of range", "2015-01-01-24", nil, "want 0 to 23"},
+		{"negative hour", "2015-01-01--1", nil, "is not YYYY-MM-DD-H"},
+		{"backwards range", "2015-01-02-0..2015-01-01-0", nil, "ends before it starts"},
+		{"range too long", "2015-01-01-0..2015-03-01-0", nil, "at most 744 per run"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			urls, err := ghArchiveURLs(tc.spec)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(urls, tc.want) {
+				t.Fatalf("got %q, want %q", urls, tc.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ module gobloombench
 go 1.22
 
 require (
-	github.com/bits-and-blooms/bitset v1.13.0 // indirect
-	github.com/bits-and-blooms/bloom/v3 v3.7.0 // indirect
+	github.com/bits-and-blooms/bloom/v3 v3.7.0
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/goccy/go-json v0.10.5
 )
+
+require github.com/bits-and-blooms/bitset v1.13.0 // indirect
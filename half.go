@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// the full filter against the half one, the built in example of what
+// filling a bloom past its capacity does. it keeps its memory and gives up
+// accuracy instead
+type HalfReport struct {
+	Entries int     `json:"entries"`
+	FullN   uint    `json:"full_n"`
+	HalfN   uint    `json:"half_n"`
+	FullFP  float64 `json:"full_fp"`
+	HalfFP  float64 `json:"half_fp"`
+	// bits of the half filter over those of the full one
+	BytesRatio float64 `json:"bytes_ratio"`
+	// how many times more false positives the half filter gives
+	FPRatio float64 `json:"fp_ratio"`
+	// entries over the half filter's capacity, past 1 it is over-filled
+	HalfFill  float64 `json:"half_fill"`
+	FullBytes int     `json:"full_bytes"`
+	HalfBytes int     `json:"half_bytes"`
+}
+
+// nil unless the run built both the full and the half filter
+func NewHalfReport(r *Result) *HalfReport {
+	var full, half *FilterResult
+	for i := range r.Filters {
+		switch r.Filters[i].Name {
+		case FILTER_FULL:
+			full = &r.Filters[i]
+		case FILTER_HALF:
+			half = &r.Filters[i]
+		}
+	}
+	if full == nil || half == nil {
+		return nil
+	}
+	return &HalfReport{
+		Entries:    r.Entries,
+		FullN:      full.N,
+		HalfN:      half.N,
+		FullFP:     full.MeasuredFP,
+		HalfFP:     half.MeasuredFP,
+		BytesRatio: float64(half.Bytes) / float64(max(full.Bytes, 1)),
+		FPRatio:    half.MeasuredFP / max(full.MeasuredFP, 1e-9),
+		HalfFill:   float64(r.Entries) / float64(max(half.N, 1)),
+		FullBytes:  full.Bytes,
+		HalfBytes:  half.Bytes,
+	}
+}
+
+// one record with the numbers nested, an object of its own with -log-json
+func (h *HalfReport) Log() {
+	slog.Info(
+		"half filter experiment",
+		slog.Group(
+			"half_experiment",
+			"entries", h.Entries,
+			"full_n", h.FullN,
+			"half_n", h.HalfN,
+			"half_fill", h.HalfFill,
+			"full_fp", h.FullFP,
+			"half_fp", h.HalfFP,
+			"fp_ratio", h.FPRatio,
+			"full_bytes", h.FullBytes,
+			"half_bytes", h.HalfBytes,
+			"bytes_ratio", h.BytesRatio,
+		),
+	)
+}
+
+func (h *HalfReport) Table(w io.Writer) {
+	fmt.Fprintf(w, "\nhalf filter experiment: %d entries into a filter sized for %d (%.1fx its capacity)\n", h.Entries, h.HalfN, h.HalfFill)
+	fmt.Fprintf(w, "  full  n=%-8d %10s  fp %.4f\n", h.FullN, humanBytes(uint64(h.FullBytes)), h.FullFP)
+	fmt.Fprintf(w, "  half  n=%-8d %10s  fp %.4f\n", h.HalfN, humanBytes(uint64(h.HalfBytes)), h.HalfFP)
+	fmt.Fprintf(w, "  %.2fx the memory for %.1fx the false positives, an over-filled bloom degrades instead of growing\n", h.BytesRatio, h.FPRatio)
+}
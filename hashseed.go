@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// what the compare run's filters add and test in place of a key. the
+// library hashes with a fixed murmur3 seed and takes no other, so -hash-seed
+// pre-hashes each key with a seeded xxhash64 and the filter hashes that.
+// the same seed and input always give the same bit set, a different seed
+// moves every key's bits while the map keeps the keys themselves
+var bloomKey = func(key string) string { return key }
+
+// the pre-hash is the 16 lowercase hex digits of xxhash64(seed, key) so
+// descriptors and /query stay readable, 0 leaves keys as they are
+func setupHashSeed(cfg *Config) {
+	bloomKey = seededKey(cfg.HashSeed)
+}
+
+// the pre-hash of seed, e.g a saved filter's own in place of -hash-seed
+func seededKey(seed uint64) func(string) string {
+	if seed == 0 {
+		return func(key string) string { return key }
+	}
+	return func(key string) string {
+		d := xxhash.NewWithSeed(seed)
+		d.WriteString(key)
+		var sum [8]byte
+		binary.BigEndian.PutUint64(sum[:], d.Sum64())
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// two filters only hold comparable bits under the same seed. an artifact
+// without a header predates the seed and is taken as is
+func sameSeed(a, b *ArtifactHeader) error {
+	if a == nil || b == nil || a.HashSeed == b.HashSeed {
+		return nil
+	}
+	return fmt.Errorf("-hash-seed %d against -hash-seed %d", a.HashSeed, b.HashSeed)
+}
+
+func bloomKeys(keys []string) []string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = bloomKey(k)
+	}
+	return out
+}
+
+func (f *Filter) AddString(key string) {
+	f.fil.AddString(bloomKey(key))
+}
+
+func (f *Filter) TestString(key string) bool {
+	return f.fil.TestString(bloomKey(key))
+}
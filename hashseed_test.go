@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// the filter a compare run builds from keys under seed
+func seededFilter(t *testing.T, seed uint64, keys []string) *bloom.BloomFilter {
+	t.Helper()
+	setupHashSeed(&Config{HashSeed: seed})
+	f := &Filter{name: FILTER_FULL, n: 1000, fil: bloom.NewWithEstimates(1000, 0.01)}
+	for _, k := range keys {
+		f.AddString(k)
+	}
+	for _, k := range keys {
+		if !f.TestString(k) {
+			t.Fatalf("seed %d: %q added and not found", seed, k)
+		}
+	}
+	return f.fil
+}
+
+func TestHashSeed(t *testing.T) {
+	t.Cleanup(func() { setupHashSeed(&Config{}) })
+	keys := syntheticIds(500, "key-")
+
+	if !seededFilter(t, 42, keys).Equal(seededFilter(t, 42, keys)) {
+		t.Fatal("the same seed and keys gave different bit sets")
+	}
+	if seededFilter(t, 42, keys).Equal(seededFilter(t, 43, keys)) {
+		t.Fatal("seeds 42 and 43 gave the same bit set")
+	}
+
+	// 0 adds the keys as they are, like a bare filter
+	plain := bloom.NewWithEstimates(1000, 0.01)
+	for _, k := range keys {
+		plain.AddString(k)
+	}
+	if !seededFilter(t, 0, keys).Equal(plain) {
+		t.Fatal("seed 0 changed the bit set")
+	}
+	if got := bloomKey("key-1"); got != "key-1" {
+		t.Fatalf("seed 0 turned key-1 into %q", got)
+	}
+}
+
+// two whole compare runs over the same input under the same seed save the
+// same bits
+func TestHashSeedRuns(t *testing.T) {
+	saved := outDir
+	t.Cleanup(func() {
+		outDir = saved
+		setupHashSeed(&Config{})
+	})
+	input := writeInput(t, "events.json", encodeEvents(t, testEvents(1500), FORMAT_ARRAY))
+
+	run := func(seed uint64) *bloom.BloomFilter {
+		cfg := testConfig(input)
+		cfg.N, cfg.FP, cfg.HalfRatio = 1000, 0.01, 0.5
+		cfg.Filters = FILTER_FULL
+		cfg.HashSeed = seed
+		cfg.OutDir = t.TempDir()
+		if err := setupOutDir(cfg); err != nil {
+			t.Fatal(err)
+		}
+		setupHashSeed(cfg)
+		if _, err := RunCompare(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		fil, err := LoadBloom(artifactPath("bloomBytes.gob"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fil
+	}
+	first := run(7)
+	if !first.Equal(run(7)) {
+		t.Fatal("two runs under seed 7 saved different bit sets")
+	}
+	if first.Equal(run(8)) {
+		t.Fatal("runs under seeds 7 and 8 saved the same bit set")
+	}
+}
+
+// a baseline saved under a seed dedups later batches under that seed, even
+// when the run dedupping them was given none
+func TestOnlyNewSeededBaseline(t *testing.T) {
+	saved := outDir
+	t.Cleanup(func() {
+		outDir = saved
+		setupHashSeed(&Config{})
+	})
+	events := testEvents(1500)
+	cfg := testConfig(writeInput(t, "events.json", encodeEvents(t, events, FORMAT_ARRAY)))
+	cfg.N, cfg.FP, cfg.HalfRatio = 1000, 0.01, 0.5
+	cfg.Filters = FILTER_FULL
+	cfg.HashSeed = 5
+	cfg.OutDir = t.TempDir()
+	if err := setupOutDir(cfg); err != nil {
+		t.Fatal(err)
+	}
+	setupHashSeed(cfg)
+	if _, err := RunCompare(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	run := testConfig(cfg.Input)
+	run.OnlyNew = artifactPath("bloomBytes.gob")
+	setupHashSeed(run)
+	newCount, seenCount, err := onlyNew(context.Background(), run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCount != 0 || seenCount != 1000 {
+		t.Fatalf("the baseline's own input gave %d new and %d seen, want 0 and 1000", newCount, seenCount)
+	}
+
+	next := events[:150]
+	for i := range next {
+		next[i].Id = "next-" + next[i].Id
+	}
+	run.Input = writeInput(t, "next.json", encodeEvents(t, next, FORMAT_ARRAY))
+	if newCount, _, err = onlyNew(context.Background(), run); err != nil {
+		t.Fatal(err)
+	}
+	// a false positive can only take a few new keys for seen ones
+	if newCount < 95 {
+		t.Fatalf("a batch of 100 new keys gave %d new", newCount)
+	}
+	hdr, _, err := LoadArtifact(run.OnlyNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.HashSeed != 5 {
+		t.Fatalf("the updated baseline was saved under -hash-seed %d, want 5", hdr.HashSeed)
+	}
+}
+
+func TestSameSeed(t *testing.T) {
+	if err := sameSeed(&ArtifactHeader{HashSeed: 1}, &ArtifactHeader{HashSeed: 2}); err == nil {
+		t.Fatal("seeds 1 and 2 compared as the same")
+	}
+	if err := sameSeed(&ArtifactHeader{HashSeed: 3}, &ArtifactHeader{HashSeed: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sameSeed(nil, &ArtifactHeader{HashSeed: 3}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+// 2^14 registers, about 0.8% standard error in 16KB
+const HLL_PRECISION = 14
+
+// fnv-1a without the allocation of hash/fnv, mixed so the high bits the
+// sketches index by are as good as the low ones
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return mix64(h)
+}
+
+// splitmix64 finalizer
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hyperloglog cardinality sketch. it only counts, membership is lost
+type HLL struct {
+	p   uint8
+	reg []uint8
+}
+
+func NewHLL(p uint8) *HLL {
+	return &HLL{p: p, reg: make([]uint8, 1<<p)}
+}
+
+func (h *HLL) AddString(key string) {
+	x := hashKey(key)
+	i := x >> (64 - h.p)
+	// the sentinel bit caps the run of zeros for the remaining bits
+	rho := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rho > h.reg[i] {
+		h.reg[i] = rho
+	}
+}
+
+func (h *HLL) Estimate() uint64 {
+	m := float64(len(h.reg))
+	sum, zeros := 0.0, 0
+	for _, r := range h.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros += 1
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// linear counting is more accurate while many registers are empty
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
+
+type HLLProcessor struct {
+	key     KeyFunc
+	sketch  *HLL
+	inserts int
+}
+
+func NewHLLProcessor(key KeyFunc, p uint8) *HLLProcessor {
+	return &HLLProcessor{key: key, sketch: NewHLL(p)}
+}
+
+func (p *HLLProcessor) Process(md *Model) {
+	if key, ok := p.key(md); ok {
+		p.sketch.AddString(key)
+		p.inserts += 1
+	}
+}
+
+func (p *HLLProcessor) Report() ProcessorReport {
+	return ProcessorReport{Name: "hll", Inserts: p.inserts, Distinct: p.sketch.Estimate(), Bytes: len(p.sketch.reg)}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// the estimate stays within three standard errors, 1.04/sqrt(m), of the
+// exact count both while linear counting applies and past it
+func TestHLLProcessorErrorBound(t *testing.T) {
+	cfg := testConfig("events.json")
+	for _, n := range []int{300, 30000, 300000} {
+		p := NewHLLProcessor(cfg.keyFunc, HLL_PRECISION)
+		mp := NewMapProcessor(cfg.keyFunc, 0)
+		events := testEvents(n)
+		for i := range events {
+			p.Process(&events[i])
+			mp.Process(&events[i])
+		}
+		r := p.Report()
+		if r.Inserts != mp.inserts {
+			t.Fatalf("n %d: %d inserts, the map saw %d", n, r.Inserts, mp.inserts)
+		}
+		exact := float64(len(mp.set))
+		bound := 3 * 1.04 / math.Sqrt(float64(int(1)<<HLL_PRECISION))
+		if rel := math.Abs(float64(r.Distinct)-exact) / exact; rel > bound {
+			t.Fatalf("n %d: estimated %d of %.0f, off by %.4f, bound %.4f", n, r.Distinct, exact, rel, bound)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// github throttles go's default user agent harder than a named client
+const USER_AGENT = "bloomvsmap"
+
+// repeatable -header "Key: Value"
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(v string) error {
+	key, _, ok := strings.Cut(v, ":")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("header %q is not Key: Value", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// the input for logs and artifact headers, without any url credentials
+func redactedInput(cfg *Config) string {
+	if !isURL(cfg.Input) {
+		return cfg.Input
+	}
+	u, err := url.Parse(cfg.Input)
+	if err != nil {
+		return "unparseable url"
+	}
+	return redactURL(u)
+}
+
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	src io.Closer
+}
+
+// closes both the gzip stream and the underlying file or body
+func (g *gzipReadCloser) Close() error {
+	err := g.Reader.Close()
+	if cerr := g.src.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sniffs the leading bytes rather than trusting an extension. saved
+// artifacts are gzipped too so they are looked for after decompressing
+func maybeGunzip(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	head, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	if string(head) != string(gzipMagic) {
+		if err := sniffArtifact(br); err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, rc}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	gzc := &gzipReadCloser{Reader: gz, src: rc}
+	zr := bufio.NewReader(gz)
+	if err := sniffArtifact(zr); err != nil {
+		gzc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, gzc}, nil
+}
+
+// an input that starts like a file this tool saved fails with what to do
+// with it, rather than as malformed json further in
+func sniffArtifact(br *bufio.Reader) error {
+	head, _ := br.Peek(br.Size())
+	switch {
+	case bytes.HasPrefix(head, rawMagic[:]):
+		return fmt.Errorf("this looks like a raw bit set saved by the compare run, not json events")
+	case bytes.HasPrefix(head, headerMagic):
+		kind := "saved"
+		if hdr, _, err := splitHeader(head); err == nil {
+			kind = hdr.Kind
+		}
+		hint := "compare two saved filters with verify -diff-filters or use one as -only-new"
+		switch kind {
+		case "map":
+			hint = "the compare run reloads it as mapBytes.gob, see verify"
+		case "checkpoint":
+			hint = "continue the run it came from with -resume"
+		}
+		return fmt.Errorf("this looks like a %s artifact, not json events: %s", kind, hint)
+	}
+	return nil
+}
+
+// credentials only ever reach the request, the log gets the scheme
+func newRequest(ctx context.Context, cfg *Config) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.Input, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", USER_AGENT+"/"+ReadBuildInfo().Version)
+	// gzip is sniffed off the body, asking for it keeps the transport from
+	// decompressing and hiding the size
+	req.Header.Set("Accept-Encoding", "gzip")
+	names := []string{}
+	for _, h := range cfg.Headers {
+		key, value, _ := strings.Cut(h, ":")
+		req.Header.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+		names = append(names, strings.TrimSpace(key))
+	}
+
+	auth := "none"
+	switch {
+	case cfg.AuthBearer != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthBearer)
+		auth = "bearer"
+	case cfg.AuthBasic != "":
+		user, pass, ok := strings.Cut(cfg.AuthBasic, ":")
+		if !ok {
+			return nil, errors.New("-auth-basic must be user:pass")
+		}
+		req.SetBasicAuth(user, pass)
+		auth = "basic"
+	}
+	// header values may carry secrets too, only their names are logged
+	slog.Debug("fetching", "url", redactURL(req.URL), "auth", auth, "headers", names)
+	return req, nil
+}
+
+// fails reads once ctx is done so a deadline also stops local files
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// the decoded input and the size its source announced, -1 when unknown.
+// a gzipped source announces its compressed size
+type inputBody struct {
+	io.Reader
+	io.Closer
+	Size int64
+}
+
+func fetch(ctx context.Context, cfg *Config) *inputBody {
+	var src io.ReadCloser
+	size := int64(-1)
+	if isURL(cfg.Input) && cfg.Cache != "" {
+		path, err := cachedInput(ctx, cfg)
+		if err != nil {
+			log.Fatalf("Error downloading input into the cache: %v", err)
+		}
+		fi, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Error opening cached input: %v", err)
+		}
+		if st, err := fi.Stat(); err == nil {
+			size = st.Size()
+		}
+		src = fi
+	} else if isURL(cfg.Input) {
+		req, err := newRequest(ctx, cfg)
+		if err != nil {
+			log.Fatalf("Error building request: %v", err)
+		}
+		resp, err := streamClient.Do(req)
+		if err != nil {
+			log.Fatal("ERROR FETCHING TEST DATA: ", err.Error())
+		}
+		if resp.StatusCode != http.StatusOK {
+			// an object store's denial is an xml body the decoder would
+			// only call malformed
+			resp.Body.Close()
+			log.Fatalf("Error fetching %s: %s", redactURL(req.URL), resp.Status)
+		}
+		src = resp.Body
+		size = resp.ContentLength
+	} else {
+		fi, err := os.Open(cfg.Input)
+		if err != nil {
+			log.Fatalf("Error opening input: %v", err)
+		}
+		if st, err := fi.Stat(); err == nil {
+			size = st.Size()
+		}
+		src = fi
+	}
+
+	body, err := maybeGunzip(src)
+	if err != nil {
+		log.Fatalf("Error reading input %s: %v", redactedInput(cfg), err)
+	}
+	return &inputBody{ctxReader{ctx, body}, body, size}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const JSON_IMPL_ALL = "all"
+
+// json implementations selectable with -json-impl. alternatives register
+// themselves from files behind build tags so they are opt in dependencies
+var tokenizers = map[string]func(io.Reader) Tokenizer{
+	"stdlib": func(r io.Reader) Tokenizer {
+		return json.NewDecoder(r)
+	},
+}
+
+// the input offset a syntax error stopped at, one extractor for each
+// implementation's error type
+var syntaxOffsets = []func(error) (int64, bool){
+	func(err error) (int64, bool) {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return syntaxErr.Offset, true
+		}
+		return 0, false
+	},
+}
+
+func tokenizerNames() []string {
+	names := make([]string, 0, len(tokenizers))
+	for name := range tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func setupTokenizer(cfg *Config) {
+	if cfg.JSONImpl == JSON_IMPL_ALL {
+		return
+	}
+	newTok, ok := tokenizers[cfg.JSONImpl]
+	if !ok {
+		log.Fatalf("unknown -json-impl %q, built with %v (alternatives need their build tag e.g -tags gojson)", cfg.JSONImpl, tokenizerNames())
+	}
+	NewTokenizer = newTok
+}
+
+// decodes the same in memory copy of the input with every implementation
+func RunJSONCompare(ctx context.Context, cfg *Config) {
+	body := fetch(ctx, cfg)
+	jsonBytes, err := readAllCapped(body, body, cfg.MaxInMemory)
+	body.Close()
+	if err != nil {
+		log.Fatalf("Error reading all data into memory: %v", err)
+	}
+
+	for _, name := range tokenizerNames() {
+		NewTokenizer = tokenizers[name]
+		start := time.Now()
+		count, err := decodeInput(ctx, cfg, bytes.NewReader(jsonBytes), func(*Model) {})
+		if err != nil {
+			log.Fatalf("Error decoding with %s: %v", name, err)
+		}
+		slog.Info("json decode", "mode", name, "count", count, "elapsed_ms", time.Since(start).Milliseconds())
+	}
+}
@@ -0,0 +1,23 @@
+//go:build gojson
+
+package main
+
+import (
+	"errors"
+	"io"
+
+	gojson "github.com/goccy/go-json"
+)
+
+func init() {
+	tokenizers["gojson"] = func(r io.Reader) Tokenizer {
+		return gojson.NewDecoder(r)
+	}
+	syntaxOffsets = append(syntaxOffsets, func(err error) (int64, bool) {
+		var syntaxErr *gojson.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return syntaxErr.Offset, true
+		}
+		return 0, false
+	})
+}
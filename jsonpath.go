@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// set when the key is a -jsonpath the Model has no field for, decoding then
+// keeps every entry's raw object in Model.Raw
+var keepRaw bool
+
+// decodes into m, through the raw object when a path needs it
+func decodeModel(dec Tokenizer, m *Model) error {
+	if !keepRaw {
+		return dec.Decode(m)
+	}
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	m.Raw = raw
+	return json.Unmarshal(raw, m)
+}
+
+// dot separated object fields and array indexes e.g payload.commits.0.sha
+func parseJSONPath(expr string) ([]string, error) {
+	path := strings.Split(expr, ".")
+	for _, seg := range path {
+		if seg == "" {
+			return nil, fmt.Errorf("empty segment in %q", expr)
+		}
+	}
+	return path, nil
+}
+
+// the value at path, strings unquoted and anything else as its json text.
+// a missing field, an index out of range and null all leave no key
+func evalJSONPath(raw json.RawMessage, path []string) (string, bool) {
+	for _, seg := range path {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			return "", false
+		}
+		switch raw[0] {
+		case '{':
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				return "", false
+			}
+			next, ok := obj[seg]
+			if !ok {
+				return "", false
+			}
+			raw = next
+		case '[':
+			i, err := strconv.Atoi(seg)
+			if err != nil {
+				return "", false
+			}
+			var arr []json.RawMessage
+			if err := json.Unmarshal(raw, &arr); err != nil || i < 0 || i >= len(arr) {
+				return "", false
+			}
+			raw = arr[i]
+		default:
+			return "", false
+		}
+	}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", false
+		}
+		return s, true
+	}
+	return string(raw), true
+}
+
+// like the built in keys only push events are included
+func jsonPathKey(path []string) KeyFunc {
+	return func(md *Model) (string, bool) {
+		if md.Type != "PushEvent" {
+			return "", false
+		}
+		return evalJSONPath(md.Raw, path)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// extracts the membership key from an event. include false leaves the event
+// out of every structure, the key is then ignored. it is called once per
+// decoded event from the decoding goroutine, or from several workers at
+// once in the concurrent modes, so it must not keep state between calls
+type KeyFunc func(md *Model) (key string, include bool)
+
+// the built in keys are fields of push events
+func pushEventField(field func(*Model) string) KeyFunc {
+	return func(md *Model) (string, bool) {
+		if md.Type != "PushEvent" {
+			return "", false
+		}
+		return field(md), true
+	}
+}
+
+// the fields behind the built in keys, read off an event of any type
+var keyFields = map[string]func(*Model) string{
+	"id":           func(md *Model) string { return md.Id },
+	"actor.login":  func(md *Model) string { return md.Actor.Login },
+	"repo.name":    func(md *Model) string { return md.Repo.Name },
+	"payload.head": func(md *Model) string { return md.Payload.Head },
+}
+
+// the keys -key picks from by name
+var keyFuncs = map[string]KeyFunc{
+	"id":           pushEventField(keyFields["id"]),
+	"actor.login":  pushEventField(keyFields["actor.login"]),
+	"repo.name":    pushEventField(keyFields["repo.name"]),
+	"payload.head": pushEventField(keyFields["payload.head"]),
+}
+
+// makes fn selectable with -key name. call it before flags are parsed, e.g
+// from an init func in a file of your own
+func RegisterKey(name string, fn KeyFunc) {
+	if _, ok := keyFuncs[name]; ok {
+		log.Fatalf("key %q registered twice", name)
+	}
+	keyFuncs[name] = fn
+}
+
+func setupKey(cfg *Config) {
+	keepRaw = false
+	if cfg.JSONPath != "" {
+		cfg.Key = cfg.JSONPath
+	}
+	fn, ok := keyFuncs[cfg.Key]
+	switch {
+	// a path naming a built in key keeps the faster struct decode
+	case ok:
+	case cfg.JSONPath != "":
+		path, err := parseJSONPath(cfg.JSONPath)
+		if err != nil {
+			log.Fatalf("bad -jsonpath: %v", err)
+		}
+		fn, keepRaw = jsonPathKey(path), true
+	default:
+		names := keysOf(keyFuncs)
+		sort.Strings(names)
+		log.Fatalf("unknown -key %q, want one of %v", cfg.Key, names)
+	}
+	cfg.rawKeyFunc, cfg.keyFunc = fn, fn
+	cfg.normalizeKey = func(key string) string { return key }
+	if cfg.Normalize {
+		normalize := func(key string) string { return strings.ToLower(strings.TrimSpace(key)) }
+		cfg.normalizeKey = normalize
+		cfg.keyFunc = func(md *Model) (string, bool) {
+			key, ok := fn(md)
+			return normalize(key), ok
+		}
+	}
+}
+
+// the key of an event of any type, for passes that split events by type. a
+// built in key reads its field off every event that has it, normalized like
+// the key itself. a registered key or -jsonpath still decides what counts
+func typeKeyFunc(cfg *Config) KeyFunc {
+	field, ok := keyFields[cfg.Key]
+	if !ok {
+		return cfg.keyFunc
+	}
+	return func(md *Model) (string, bool) {
+		key := cfg.normalizeKey(field(md))
+		return key, key != ""
+	}
+}
+
+// distinct keys with and without -normalize, the raw ones counted in a pass
+// of their own so the measured stages only ever hold the normalized set
+func reportNormalized(ctx context.Context, cfg *Config, normalized int) {
+	raw := map[string]bool{}
+	if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+		if key, ok := cfg.rawKeyFunc(md); ok {
+			raw[key] = true
+		}
+	})); err != nil {
+		log.Fatalf("Error reading input: %v", err)
+	}
+	slog.Info(
+		"normalize",
+		"key", cfg.Key,
+		"raw_distinct", len(raw),
+		"normalized_distinct", normalized,
+		"merged", len(raw)-normalized,
+	)
+}
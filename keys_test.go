@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// the keys events give under cfg's -key, in order
+func keysFor(cfg *Config, events []Model) []string {
+	setupKey(cfg)
+	var keys []string
+	for i := range events {
+		if key, ok := cfg.keyFunc(&events[i]); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// a registered KeyFunc decides both the key and which events count, the
+// push event filter of the built in keys does not apply to it
+func TestRegisterKey(t *testing.T) {
+	RegisterKey("test.watch", func(md *Model) (string, bool) {
+		return "Watch-" + md.Id, md.Type == "WatchEvent"
+	})
+	cfg := testConfig("events.json")
+	cfg.Key = "test.watch"
+
+	got := keysFor(cfg, testEvents(7))
+	if want := []string{"Watch-0", "Watch-3", "Watch-6"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// -normalize wraps it like a built in key
+	cfg.Normalize = true
+	got = keysFor(cfg, testEvents(4))
+	if want := []string{"watch-0", "watch-3"}; !slices.Equal(got, want) {
+		t.Fatalf("normalized got %v, want %v", got, want)
+	}
+}
+
+func TestBuiltinKeysPushOnly(t *testing.T) {
+	cfg := testConfig("events.json")
+	cfg.Key = "id"
+	if got, want := keysFor(cfg, testEvents(7)), []string{"1", "2", "4", "5"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+// split by type every event counts, the built in keys lose their push
+// filter and -normalize still applies
+func TestTypeKeyFunc(t *testing.T) {
+	cfg := testConfig("events.json")
+	cfg.Key = "actor.login"
+	cfg.Normalize = true
+	setupKey(cfg)
+	events := testEvents(2)
+	events[0].Actor.Login = " Alice"
+	events[1].Actor.Login = "BOB "
+	key := typeKeyFunc(cfg)
+	for i, want := range []string{"alice", "bob"} {
+		if got, ok := key(&events[i]); !ok || got != want {
+			t.Fatalf("%s: got %q %v, want %q", events[i].Type, got, ok, want)
+		}
+	}
+	// an event without the field is left out rather than keyed ""
+	cfg.Key = "payload.head"
+	setupKey(cfg)
+	if _, ok := typeKeyFunc(cfg)(&events[0]); ok {
+		t.Fatal("an empty payload.head was included")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log/slog"
+	"math/bits"
+	"time"
+)
+
+// sub buckets per power of two, 2 bits keeps every bucket within 25%
+const LATENCY_SUB_BITS = 2
+
+// log scale histogram of durations. a fixed array of counters, so recording
+// is a few instructions and quantiles come out approximate, never from a
+// stored sample
+type LatencyHistogram struct {
+	counts [64 << LATENCY_SUB_BITS]uint64
+	total  uint64
+	max    time.Duration
+}
+
+func latencyBucket(ns uint64) int {
+	if ns < 1<<LATENCY_SUB_BITS {
+		return int(ns)
+	}
+	exp := bits.Len64(ns) - 1
+	sub := (ns >> (exp - LATENCY_SUB_BITS)) & (1<<LATENCY_SUB_BITS - 1)
+	return (exp-LATENCY_SUB_BITS+1)<<LATENCY_SUB_BITS + int(sub)
+}
+
+// the largest duration that lands in bucket i
+func latencyUpper(i int) uint64 {
+	if i < 1<<LATENCY_SUB_BITS {
+		return uint64(i)
+	}
+	exp := i>>LATENCY_SUB_BITS + LATENCY_SUB_BITS - 1
+	sub := uint64(i & (1<<LATENCY_SUB_BITS - 1))
+	width := uint64(1) << (exp - LATENCY_SUB_BITS)
+	return 1<<exp + sub*width + width - 1
+}
+
+func (h *LatencyHistogram) Record(d time.Duration) {
+	h.counts[latencyBucket(uint64(max(d, 0)))] += 1
+	h.total += 1
+	h.max = max(h.max, d)
+}
+
+// the upper bound of the bucket holding the q quantile
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	target := uint64(q * float64(h.total))
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen > target {
+			return min(time.Duration(latencyUpper(i)), h.max)
+		}
+	}
+	return h.max
+}
+
+// set for the length of a pass with -decode-latency, nil otherwise so the
+// decoders skip the clock reads
+var decodeLatency *LatencyHistogram
+
+func timedDecode(dec Tokenizer, m *Model) error {
+	if decodeLatency == nil {
+		return decodeModel(dec, m)
+	}
+	start := time.Now()
+	err := decodeModel(dec, m)
+	decodeLatency.Record(time.Since(start))
+	return err
+}
+
+func startDecodeLatency(cfg *Config) {
+	if cfg.DecodeLatency {
+		decodeLatency = &LatencyHistogram{}
+	}
+}
+
+// spikes past p99 are gc pauses or huge entries e.g pushes with many commits
+func reportDecodeLatency(mode string) {
+	if decodeLatency == nil {
+		return
+	}
+	slog.Info(
+		"decode latency",
+		"mode", mode,
+		"count", decodeLatency.total,
+		"p50_us", decodeLatency.Quantile(0.5).Microseconds(),
+		"p90_us", decodeLatency.Quantile(0.9).Microseconds(),
+		"p99_us", decodeLatency.Quantile(0.99).Microseconds(),
+		"p999_us", decodeLatency.Quantile(0.999).Microseconds(),
+		"max_us", decodeLatency.max.Microseconds(),
+	)
+	decodeLatency = nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// installs the default slog logger. log.Fatal calls that remain for
+// unrecoverable errors are bridged through it at error level
+func setupLogging(cfg *Config) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(cfg.LogLevel))); err != nil {
+		log.Fatalf("bad -log-level %q: %v", cfg.LogLevel, err)
+	}
+
+	// errors still get through, they explain a non-zero exit
+	if cfg.Quiet {
+		level = slog.LevelError
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if cfg.LogJSON {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	slog.SetLogLoggerLevel(slog.LevelError)
+}
+
+var byteUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// n in the largest binary unit it reaches e.g 1536 is 1.5 KiB, below a KiB
+// it stays exact bytes
+func humanBytes(n uint64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n) / 1024
+	unit := 0
+	for v >= 1024 && unit < len(byteUnits)-1 {
+		v /= 1024
+		unit += 1
+	}
+	return fmt.Sprintf("%.1f %s", v, byteUnits[unit])
+}
+
+// a difference of two reads, alloc can drop between them when a gc runs
+func humanDelta(old, new uint64) string {
+	return signedBytes(int64(new) - int64(old))
+}
+
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + humanBytes(uint64(-n))
+	}
+	return humanBytes(uint64(n))
+}
+
+// signed, alloc can drop between two reads when a gc runs in between. in
+// decimal MB like the *_mb columns always were, humanBytes is for display
+func deltaMB(old, new uint64) int64 {
+	return (int64(new) - int64(old)) / 1000000
+}
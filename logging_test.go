@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestHumanBytes(t *testing.T) {
+	for _, tc := range []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1, "1 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1<<20 - 1, "1024.0 KiB"},
+		{1 << 20, "1.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+		{3 << 40, "3.0 TiB"},
+		{1 << 60, "1.0 EiB"},
+		// past the last unit it keeps counting in it
+		{1<<64 - 1, "16.0 EiB"},
+	} {
+		if got := humanBytes(tc.n); got != tc.want {
+			t.Errorf("humanBytes(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestSignedBytes(t *testing.T) {
+	for _, tc := range []struct {
+		old, new uint64
+		want     string
+	}{
+		{0, 2048, "2.0 KiB"},
+		{2048, 0, "-2.0 KiB"},
+		{100, 100, "0 B"},
+		{1 << 20, 1<<20 + 512, "512 B"},
+	} {
+		if got := humanDelta(tc.old, tc.new); got != tc.want {
+			t.Errorf("humanDelta(%d, %d) = %q, want %q", tc.old, tc.new, got, tc.want)
+		}
+	}
+}
+
+// the *_mb columns stay decimal megabytes, signed and truncated
+func TestDeltaMB(t *testing.T) {
+	for _, tc := range []struct {
+		old, new uint64
+		want     int64
+	}{
+		{0, 1000000, 1},
+		{0, 1 << 20, 1},
+		{0, 999999, 0},
+		{0, 5500000, 5},
+		{3000000, 0, -3},
+	} {
+		if got := deltaMB(tc.old, tc.new); got != tc.want {
+			t.Errorf("deltaMB(%d, %d) = %d, want %d", tc.old, tc.new, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// exact membership over the most recent capacity keys. older keys are
+// evicted so memory is bounded but recall is not
+type LRUSet struct {
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+func NewLRUSet(capacity int) *LRUSet {
+	return &LRUSet{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// reports whether key was in the window and makes it the most recent
+func (l *LRUSet) TestAndAdd(key string) bool {
+	if el, ok := l.items[key]; ok {
+		l.order.MoveToFront(el)
+		return true
+	}
+	l.items[key] = l.order.PushFront(key)
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(string))
+	}
+	return false
+}
+
+func (l *LRUSet) Len() int {
+	return l.order.Len()
+}
+
+// heap kept alive by build, collected before and after. the second
+// collection empties the sync.Pool victim caches the decoder left behind
+func retainedBy(build func()) int64 {
+	var m1, m2 runtime.MemStats
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+	build()
+	runtime.GC()
+	runtime.ReadMemStats(&m2)
+	return int64(m2.HeapAlloc) - int64(m1.HeapAlloc)
+}
+
+// replays the keys through an lru window and a bloom as recently seen
+// dedupers. an exact pass first marks which keys really are repeats
+func RunLRU(ctx context.Context, cfg *Config) {
+	if cfg.LRU <= 0 {
+		log.Fatalf("-lru must be positive, got %d", cfg.LRU)
+	}
+	ids := collectIds(ctx, cfg)
+
+	repeat := make([]bool, len(ids))
+	seen := map[string]bool{}
+	for i, id := range ids {
+		repeat[i] = seen[id]
+		seen[id] = true
+	}
+	repeats := 0
+	for _, r := range repeat {
+		if r {
+			repeats += 1
+		}
+	}
+	seen = nil
+
+	var lru *LRUSet
+	var lruHits, evictionMisses int
+	lruRetained := retainedBy(func() {
+		lru = NewLRUSet(cfg.LRU)
+		for i, id := range ids {
+			if lru.TestAndAdd(id) {
+				lruHits += 1
+			} else if repeat[i] {
+				evictionMisses += 1
+			}
+		}
+	})
+
+	var fil *bloom.BloomFilter
+	var bloomHits, falseHits int
+	bloomRetained := retainedBy(func() {
+		fil = bloom.NewWithEstimates(cfg.N, cfg.FP)
+		for i, id := range ids {
+			if fil.TestAndAddString(id) {
+				bloomHits += 1
+				if !repeat[i] {
+					falseHits += 1
+				}
+			}
+		}
+	})
+	// otherwise they die during the bloom build and show up as negative retention
+	runtime.KeepAlive(ids)
+	runtime.KeepAlive(repeat)
+
+	slog.Info("recently seen", "inserts", len(ids), "repeats", repeats)
+	slog.Info(
+		"lru",
+		"capacity", cfg.LRU,
+		"len", lru.Len(),
+		"hits", lruHits,
+		"eviction_misses", evictionMisses,
+		"hit_rate", float64(lruHits)/float64(max(repeats, 1)),
+		"retained_bytes", lruRetained,
+	)
+	slog.Info(
+		"bloom",
+		"n", cfg.N,
+		"fp", cfg.FP,
+		"hits", bloomHits,
+		"false_hits", falseHits,
+		"bloom_bytes", fil.BitSet().BinaryStorageSize(),
+		"retained_bytes", bloomRetained,
+	)
+}
@@ -7,15 +7,20 @@ import (
 	"context"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"log/slog"
+	"maps"
 	"os"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bits-and-blooms/bloom/v3"
@@ -26,6 +31,20 @@ import (
 const LARGE_JSON_FILE = "https://raw.githubusercontent.com/json-iterator/test-data/master/large-file.json"
 const TRACE_FILE = "bloomtrace.trace.out"
 
+// -output formats for the compare result on stdout
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_CSV   = "csv"
+	OUTPUT_NONE  = "none"
+)
+
+// expected push events and false positive rate the filters are sized for
+const (
+	BLOOM_N  = 12000
+	BLOOM_FP = 0.1
+)
+
 type Model struct {
 	Id        string `json:"id"`
 	Type      string `json:"type"`
@@ -63,11 +82,124 @@ type Model struct {
 			Url      string `json:"url"`
 		} `json:"commits"`
 	} `json:"payload"`
+	// the whole object, only kept for a -jsonpath key
+	Raw json.RawMessage `json:"-"`
+}
+
+// CreatedAt is RFC3339 in the github events feed
+func (m *Model) CreatedTime() (time.Time, error) {
+	return time.Parse(time.RFC3339, m.CreatedAt)
 }
 
 type Config struct {
 	TracingEnabled bool
 	TraceFile      string
+	BucketBy       string
+	BucketCap      uint
+	QueryBucket    string
+	QueryId        string
+	Workers        int
+	Buffer         int
+	Presize        bool
+	Input          string
+	OnlyNew        string
+	Negatives      int
+	HalfRatio      float64
+	AuthBearer     string
+	AuthBasic      string
+	JSONImpl       string
+	Types          bool
+	Format         string
+	LineBuffer     int
+	Compact        bool
+	Sorted         bool
+	CPUProfile     string
+	MaxDuration    time.Duration
+	RegionOverhead bool
+	Headers        []string
+	Reuse          bool
+	Iterations     int
+	LogLevel       string
+	LogJSON        bool
+	N              uint
+	FP             float64
+	Manifest       string
+	CSV            string
+	ArrayKey       string
+	Commits        bool
+	Filters        string
+	Cache          string
+	OutDir         string
+	Retries        int
+	Key            string
+	Serve          string
+	DumpIds        string
+	LRU            int
+	QueryCount     int
+	QueryHitRatio  float64
+	MemLimit       int64
+	ConfirmWorkers int
+	Overfill       bool
+	Normalize      bool
+	BloomM         uint
+	BloomK         uint
+	FPCost         time.Duration
+	Explain        bool
+	Novelty        string
+	Processors     string
+	RefreshCache   bool
+	AllowPartial   bool
+	DecodeLatency  bool
+	TransformOut   string
+	ListenSocket   string
+	BloomPretest   bool
+	GHArchive      string
+	Retained       bool
+	Quiet          bool
+	Output         string
+	MaxInMemory    int64
+	ApproxEvery    int
+	OpenSet        bool
+	JSONPath       string
+	TargetCV       float64
+	MaxIterations  int
+	ExportJSON     string
+	Sparkline      int
+	TypeFilters    bool
+	GzipLevel      int
+	Verify         bool
+	Baseline       string
+	UpdateBaseline bool
+	BaselinePct    float64
+	S3Endpoint     string
+	HashSeed       uint64
+	DiffFilters    string
+	OrderCheck     string
+	Checkpoint     time.Duration
+	Resume         bool
+	Adversarial    bool
+	MetricsFile    string
+	InMemory       bool
+
+	// set by setupKey from -key, -jsonpath and -normalize
+	keyFunc KeyFunc
+	// the key before -normalize
+	rawKeyFunc KeyFunc
+	// applied to lookups so they match what was inserted
+	normalizeKey func(string) string
+	// how the passes of this run ended
+	state runState
+}
+
+// set by the readers when a pass ends short of the input, read by Confirm
+// and the run's status
+type runState struct {
+	// an in-memory pass gave up at -mem-limit
+	memLimited bool
+	// a pass stopped at -max-duration instead of the end
+	timedOut bool
+	// a pass ended on a truncated input kept with -allow-partial
+	truncated bool
 }
 
 // call and defer after
@@ -133,257 +265,1217 @@ func setupTracing(cfg *Config) func() {
 	}
 }
 
-var (
-	pushEventMap map[string]bool = map[string]bool{}
-	blomfil                      = bloom.NewWithEstimates(12000, 0.1)
-	halfblomfil                  = bloom.NewWithEstimates(6000, 0.1)
-)
+// gc cycles and total stop the world pause between two reads
+func gcDelta(mOld, mNew *runtime.MemStats) (uint32, time.Duration) {
+	return mNew.NumGC - mOld.NumGC, time.Duration(mNew.PauseTotalNs - mOld.PauseTotalNs)
+}
 
-func memUsage(mOld, mNew *runtime.MemStats) {
-	fmt.Println(
-		fmt.Sprintf(
-			"[Alloc]: %d, [Heap]: %d, [Total]: %d  MBs BloomFil: (%d , %d) ",
-			((mNew.Alloc - mOld.Alloc) / 1000000),
-			((mNew.HeapAlloc - mOld.HeapAlloc) / 1000000),
-			((mNew.TotalAlloc - mOld.TotalAlloc) / 1000000),
-			blomfil.ApproximatedSize(),
-			blomfil.BitSet().BinaryStorageSize(),
-		))
+// heap objects allocated, freed and still live between two reads. the
+// count, more than the bytes, is what the gc has to trace
+func objectDelta(mOld, mNew *runtime.MemStats) (uint64, uint64, int64) {
+	mallocs, frees := mNew.Mallocs-mOld.Mallocs, mNew.Frees-mOld.Frees
+	return mallocs, frees, int64(mallocs) - int64(frees)
 }
 
-func ProcessChunkUsingMap(md *Model) {
-	if md.Type == "PushEvent" {
-		pushEventMap[md.Id] = true
-	}
+func memUsage(mode string, fils []*Filter, mOld, mNew *runtime.MemStats) {
+	cycles, pause := gcDelta(mOld, mNew)
+	mallocs, frees, live := objectDelta(mOld, mNew)
+	slog.Info(
+		"mem usage",
+		"mode", mode,
+		"alloc", humanDelta(mOld.Alloc, mNew.Alloc),
+		"heap", humanDelta(mOld.HeapAlloc, mNew.HeapAlloc),
+		"total", humanDelta(mOld.TotalAlloc, mNew.TotalAlloc),
+		"mallocs", mallocs,
+		"frees", frees,
+		"live_objects", live,
+		"num_gc", cycles,
+		"gc_pause_us", pause.Microseconds(),
+		"filters", len(fils),
+		"bloom", humanBytes(uint64(filterBytes(fils))),
+	)
 }
 
-func ProcessChunkUsingBloom(md *Model) {
-	if md.Type == "PushEvent" {
-		blomfil.AddString(md.Id)
-		halfblomfil.AddString(md.Id)
+// accumulates the time spent inside proc, leaving out fetching and decoding
+func timeProc(proc func(*Model), total *time.Duration) func(*Model) {
+	return func(md *Model) {
+		start := time.Now()
+		proc(md)
+		*total += time.Since(start)
 	}
 }
 
-func readAllInMemoryInternal(ctx context.Context, cfg *Config, proc func(*Model)) {
-	client := http.Client{
-		Timeout: 15 * time.Second,
+func timeIt(fn func()) time.Duration {
+	start := time.Now()
+	fn()
+	return time.Since(start)
+}
+
+// satisfied by *json.Decoder, swap NewTokenizer to drive decodeStream with
+// another json implementation
+type Tokenizer interface {
+	Token() (json.Token, error)
+	More() bool
+	Decode(v any) error
+}
+
+var NewTokenizer = tokenizers["stdlib"]
+
+// skips the fields of an object until arrayKey and consumes the opening
+// bracket of its array, leaving dec at the first element
+func seekArray(dec Tokenizer, arrayKey string) error {
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("token decoding error: %w", err)
+		}
+		if key != arrayKey {
+			if err := dec.Decode(&json.RawMessage{}); err != nil {
+				return fmt.Errorf("skipping field %v: %w", key, err)
+			}
+			continue
+		}
+		toke, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("token decoding error: %w", err)
+		}
+		if toke != json.Delim('[') {
+			return fmt.Errorf("%q is not an array, starts with %v", arrayKey, toke)
+		}
+		return nil
 	}
-	req, err := client.Get(LARGE_JSON_FILE)
-	if err != nil {
-		log.Fatal("ERROR FETCHING TEST DATA: ", err.Error())
+	return fmt.Errorf("no %q array in the top level object", arrayKey)
+}
+
+// input that is not a json array or an object wrapping one
+var errMalformed = errors.New("malformed input")
+
+// decodes a json array of models from r calling proc for each element. an
+// object wrapping the array e.g {"events": [...]} is unwrapped by arrayKey
+func decodeStream(ctx context.Context, r io.Reader, arrayKey string, proc func(*Model)) (count int, err error) {
+	src := &endReader{r: r}
+	dec := NewTokenizer(src)
+	toke, err := dec.Token()
+	// an empty body holds no entries, it is not malformed
+	if errors.Is(err, io.EOF) {
+		return 0, nil
 	}
-	var dataModel []Model
-	jsonBytes, err := io.ReadAll(req.Body)
 	if err != nil {
-		log.Fatalf("Error reading all data into memory: %v", err)
+		return 0, fmt.Errorf("%w, token decoding error: %v", errMalformed, err)
 	}
-	if err := json.Unmarshal(jsonBytes, &dataModel); err != nil {
-		log.Fatalf("Error Unmarshalling data into memory: %v", err)
+	switch toke {
+	case json.Delim('['):
+	case json.Delim('{'):
+		if err := seekArray(dec, arrayKey); err != nil {
+			return 0, fmt.Errorf("%w, %v", errMalformed, err)
+		}
+	default:
+		return 0, fmt.Errorf("%w, not a json array or object, starts with %v", errMalformed, toke)
 	}
-	for _, m := range dataModel {
+	for dec.More() {
+		// buffered input decodes without reading, so ctxReader alone would
+		// only notice a cancel at the next refill
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		default:
+		}
+		m := Model{}
+		if err := timedDecode(dec, &m); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				return count, asTruncation(err, src)
+			}
+			// the decoder can carry on past a badly typed field
+			slog.Warn("skipping entry", "err", err)
+			continue
+		}
 		proc(&m)
+		count += 1
 	}
-	log.Println("entries: %d", len(dataModel))
+	// a stream cut between entries ends as cleanly as a complete one, only
+	// the closing bracket tells them apart
+	if _, err := dec.Token(); err != nil {
+		return count, fmt.Errorf("array not closed, %v: %w", err, io.ErrUnexpectedEOF)
+	}
+	return count, nil
 }
 
-func readAllInMemoryInternalBuffered(ctx context.Context, cfg *Config, proc func(*Model)) {
-	client := http.Client{
-		Timeout: 15 * time.Second,
-	}
-	req, err := client.Get(LARGE_JSON_FILE)
-	if err != nil {
-		log.Fatal("ERROR FETCHING TEST DATA: ", err.Error())
-	}
-	var dataModel []Model
-	jsonBytes, err := io.ReadAll(bufio.NewReader(req.Body))
-	if err != nil {
-		log.Fatalf("Error reading all data into memory: %v", err)
+// counts what a decoder has read so its errors can be placed against the
+// end of the input
+type endReader struct {
+	r   io.Reader
+	n   int64
+	eof bool
+}
+
+func (e *endReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.n += int64(n)
+	if err == io.EOF {
+		e.eof = true
 	}
-	if err := json.Unmarshal(jsonBytes, &dataModel); err != nil {
-		log.Fatalf("Error Unmarshalling data into memory: %v", err)
+	return n, err
+}
+
+// input ending mid entry comes back as io.ErrUnexpectedEOF or as a syntax
+// error, depending on the implementation and where it stopped. a syntax
+// error is only the end of the input when nothing is left after it
+func asTruncation(err error, src *endReader) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || !src.eof {
+		return err
 	}
-	for _, m := range dataModel {
-		proc(&m)
+	for _, offset := range syntaxOffsets {
+		if off, ok := offset(err); ok && off >= src.n {
+			return fmt.Errorf("%v: %w", err, io.ErrUnexpectedEOF)
+		}
 	}
-	log.Println("entries: %d", len(dataModel))
+	return err
 }
 
-func ReadAllInMemory(ctx context.Context, cfg *Config, proc func(*Model)) {
-	if trace.IsEnabled() {
-		trace.WithRegion(ctx, "readAllInMemory", func() {
-			readAllInMemoryInternal(ctx, cfg, proc)
-		})
-	} else {
-		readAllInMemoryInternal(ctx, cfg, proc)
+// a dropped connection or a cut short file ends the input mid entry. the
+// entries before it are only used when asked for
+func keepTruncated(cfg *Config, count int, err error) error {
+	if !cfg.AllowPartial {
+		return fmt.Errorf("input truncated after %d entries, -allow-partial keeps them: %w", count, err)
 	}
+	slog.Warn("input truncated, keeping the entries before it", "count", count, "err", err)
+	cfg.state.truncated = true
+	return nil
 }
 
-func ReadAllInMemoryBuffered(ctx context.Context, cfg *Config, proc func(*Model)) {
-	if trace.IsEnabled() {
-		trace.WithRegion(ctx, "readAllInMemory", func() {
-			readAllInMemoryInternalBuffered(ctx, cfg, proc)
-		})
-	} else {
-		readAllInMemoryInternalBuffered(ctx, cfg, proc)
+// the readers return what stops them short of the end, malformed input
+// included. a timeout or a kept truncation is not an error, the pass
+// records it and the caller reports what was read
+func readAllInMemoryInternal(ctx context.Context, cfg *Config, buffered bool, procs []Processor) error {
+	if cfg.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxDuration)
+		defer cancel()
 	}
-}
 
-func readAllStreamingBufferedInternal(ctx context.Context, cfg *Config, proc func(*Model)) {
-	client := http.Client{
-		Timeout: 15 * time.Second,
+	start := time.Now()
+	body := fetch(ctx, cfg)
+	defer body.Close()
+
+	var r io.Reader = body
+	if buffered {
+		r = bufio.NewReader(body)
 	}
-	req, err := client.Get(LARGE_JSON_FILE)
-	if err != nil {
-		log.Fatal("ERROR FETCHING TEST DATA: ", err.Error())
-	}
-	dec := json.NewDecoder(bufio.NewReader(req.Body))
-	var dataModel []Model
-	if toke, err := dec.Token(); err != nil {
-		log.Fatalf("Token decoding error: %v %v", toke, err)
-	} else {
-		for dec.More() {
-			m := Model{}
-			if err := dec.Decode(&m); err != nil {
-				log.Println("decoding err => ", err.Error())
-			} else {
-				proc(&m)
-				dataModel = append(dataModel, m)
-			}
+	if cfg.MemLimit > 0 {
+		r = &memGuardReader{r: r, limit: uint64(cfg.MemLimit) * 1000000}
+	}
+	jsonBytes, err := readAllCapped(body, r, cfg.MaxInMemory)
+	if errors.Is(err, errMemLimit) || errors.Is(err, errTooLarge) {
+		// reported as a result, this mode is infeasible at this limit
+		cfg.state.memLimited = true
+		slog.Error("in-memory mode infeasible at this memory limit", "err", err)
+		return nil
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("reading all data into memory: %w", err)
+	}
+	status := "completed"
+	count := 0
+	if err == nil {
+		startDecodeLatency(cfg)
+		count, err = decodeInput(ctx, cfg, bytes.NewReader(jsonBytes), drive(procs))
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		status = "timed out"
+		cfg.state.timedOut = true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		if err := keepTruncated(cfg, count, err); err != nil {
+			return err
 		}
+		status = "truncated"
+	default:
+		return fmt.Errorf("decoding in memory after %d entries: %w", count, err)
 	}
-	log.Println("entries: %d", len(dataModel))
+	traceEntries(ctx, count, procs)
+	reportDecodeLatency("in-memory")
+	slog.Info("entries", "mode", "in-memory", "buffered", buffered, "count", count, "status", status, "elapsed_ms", time.Since(start).Milliseconds())
+	return nil
 }
 
-func readAllStreamingInternal(ctx context.Context, cfg *Config, proc func(*Model)) {
-	client := http.Client{
-		Timeout: 15 * time.Second,
+func readAllStreamingInternal(ctx context.Context, cfg *Config, buffered bool, procs []Processor) error {
+	if cfg.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxDuration)
+		defer cancel()
 	}
-	req, err := client.Get(LARGE_JSON_FILE)
-	if err != nil {
-		log.Fatal("ERROR FETCHING TEST DATA: ", err.Error())
-	}
-	dec := json.NewDecoder(req.Body)
-	var dataModel []Model
-	if toke, err := dec.Token(); err != nil {
-		log.Fatalf("Token decoding error: %v %v", toke, err)
-	} else {
-		for dec.More() {
-			m := Model{}
-			if err := dec.Decode(&m); err != nil {
-				log.Println("decoding err => ", err.Error())
-			} else {
-				dataModel = append(dataModel, m)
-				proc(&m)
-			}
+
+	start := time.Now()
+	body := fetch(ctx, cfg)
+	defer body.Close()
+
+	var r io.Reader = body
+	if buffered {
+		r = bufio.NewReader(body)
+	}
+	status := "completed"
+	startDecodeLatency(cfg)
+	count, err := decodeInput(ctx, cfg, r, drive(procs))
+	// keep what was processed, the caller reports and saves it as is
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		status = "timed out"
+		cfg.state.timedOut = true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		if err := keepTruncated(cfg, count, err); err != nil {
+			return err
 		}
+		status = "truncated"
+	default:
+		return fmt.Errorf("decoding stream after %d entries: %w", count, err)
 	}
-	log.Println("entries: %d", len(dataModel))
+	traceEntries(ctx, count, procs)
+	reportDecodeLatency("streaming")
+	slog.Info("entries", "mode", "streaming", "buffered", buffered, "count", count, "status", status, "elapsed_ms", time.Since(start).Milliseconds())
+	return nil
 }
 
-func ReadAllStreaming(ctx context.Context, cfg *Config, proc func(*Model)) {
+func ReadAllInMemory(ctx context.Context, cfg *Config, procs ...Processor) (err error) {
+	if trace.IsEnabled() {
+		trace.WithRegion(ctx, "readAllInMemory", func() {
+			err = readAllInMemoryInternal(ctx, cfg, false, procs)
+		})
+		return err
+	}
+	return readAllInMemoryInternal(ctx, cfg, false, procs)
+}
+
+func ReadAllInMemoryBuffered(ctx context.Context, cfg *Config, procs ...Processor) (err error) {
+	if trace.IsEnabled() {
+		trace.WithRegion(ctx, "readAllInMemory", func() {
+			err = readAllInMemoryInternal(ctx, cfg, true, procs)
+		})
+		return err
+	}
+	return readAllInMemoryInternal(ctx, cfg, true, procs)
+}
+
+func ReadAllStreaming(ctx context.Context, cfg *Config, procs ...Processor) (err error) {
 	if trace.IsEnabled() {
 		trace.WithRegion(ctx, "readAllStreaming", func() {
-			readAllStreamingInternal(ctx, cfg, proc)
+			err = readAllStreamingInternal(ctx, cfg, false, procs)
 		})
-	} else {
-		readAllStreamingInternal(ctx, cfg, proc)
+		return err
 	}
+	return readAllStreamingInternal(ctx, cfg, false, procs)
 }
 
-func ReadAllStreamingBuffered(ctx context.Context, cfg *Config, proc func(*Model)) {
+func ReadAllStreamingBuffered(ctx context.Context, cfg *Config, procs ...Processor) (err error) {
 	if trace.IsEnabled() {
 		trace.WithRegion(ctx, "readAllStreaming", func() {
-			readAllStreamingBufferedInternal(ctx, cfg, proc)
+			err = readAllStreamingInternal(ctx, cfg, true, procs)
 		})
-	} else {
-		readAllStreamingBufferedInternal(ctx, cfg, proc)
+		return err
 	}
+	return readAllStreamingInternal(ctx, cfg, true, procs)
 }
 
-func Save(filename string, data []byte) error {
+// set from -gzip-level. bloom bit sets are close to random so the faster
+// levels cost them little size
+var gzipLevel = gzip.DefaultCompression
 
+// gzips data into filename. the gzip footer is only written on Close, so
+// its error and the file's decide whether the artifact is readable
+func Save(filename string, data []byte) (err error) {
+	start := time.Now()
 	fi, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if cerr := fi.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	fz, err := gzip.NewWriterLevel(fi, gzipLevel)
+	if err != nil {
+		return err
+	}
+	if _, err := fz.Write(data); err != nil {
+		return err
+	}
+	if err := fz.Close(); err != nil {
+		return err
+	}
+	// the gzip stream is written through, the size is final before the close
+	if st, err := fi.Stat(); err == nil {
+		slog.Info(
+			"saved",
+			"file", filename,
+			"gzip_level", gzipLevel,
+			"bytes", len(data),
+			"gzip_bytes", st.Size(),
+			"ratio", float64(st.Size())/float64(max(len(data), 1)),
+			"elapsed_us", time.Since(start).Microseconds(),
+		)
+	}
+	return nil
+}
+
+// reverses Save
+func Load(filename string) ([]byte, error) {
+	fi, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
 	defer fi.Close()
 
-	fz := gzip.NewWriter(fi)
+	fz, err := gzip.NewReader(fi)
+	if err != nil {
+		return nil, err
+	}
 	defer fz.Close()
 
-	fz.Write(data)
+	return io.ReadAll(fz)
+}
 
-	return err
+// tests every id against f returning how many tested positive
+func TestMany(f *bloom.BloomFilter, ids []string) int {
+	positives := 0
+	for _, id := range ids {
+		if f.TestString(id) {
+			positives += 1
+		}
+	}
+	return positives
 }
 
-func Confirm() {
-	hitCount := 0
-	missCount := 0
-	halfCoount := 0
-	mhalfCount := 0
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
 
-	for k, _ := range pushEventMap {
-		if blomfil.TestString(k) {
-			hitCount += 1
-		} else {
-			missCount += 1
+// inserted keys that f claims it has never seen
+func falseNegatives(f *Filter, keys []string) []string {
+	var missing []string
+	for _, k := range keys {
+		if !f.TestString(k) {
+			missing = append(missing, k)
 		}
+	}
+	return missing
+}
+
+// splits keys across workers. reads never modify the filter so TestString
+// needs no locking, each worker keeps its own misses and adds its hits
+func falseNegativesParallel(f *Filter, keys []string, workers int) ([]string, int64) {
+	var hits atomic.Int64
+	var wg sync.WaitGroup
+	parts := make([][]string, workers)
+	chunk := (len(keys) + workers - 1) / workers
+	for w := range parts {
+		lo, hi := min(w*chunk, len(keys)), min((w+1)*chunk, len(keys))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[w] = falseNegatives(f, keys[lo:hi])
+			hits.Add(int64(hi - lo - len(parts[w])))
+		}()
+	}
+	wg.Wait()
+
+	var missing []string
+	for _, p := range parts {
+		missing = append(missing, p...)
+	}
+	return missing, hits.Load()
+}
 
-		if halfblomfil.TestString(k) {
-			halfCoount += 1
+// a bloom filter never forgets an inserted key, so every map key must hit.
+// a miss means insertion or serialization is broken and is returned as an
+// error. false positives are only measured and reported, one per filter
+func Confirm(cfg *Config, set map[string]bool, fils []*Filter) (fps []FalsePositiveReport, err error) {
+	keys := keysOf(set)
+
+	fps = make([]FalsePositiveReport, len(fils))
+	for i, f := range fils {
+		var missing []string
+		if cfg.ConfirmWorkers > 1 {
+			// the serial pass is kept alongside to report the speedup
+			var hits int64
+			serial := timeIt(func() { falseNegatives(f, keys) })
+			parallel := timeIt(func() { missing, hits = falseNegativesParallel(f, keys, cfg.ConfirmWorkers) })
+			slog.Info(
+				"confirm parallel",
+				"filter", f.name,
+				"workers", cfg.ConfirmWorkers,
+				"hits", hits,
+				"serial_us", serial.Microseconds(),
+				"parallel_us", parallel.Microseconds(),
+				"speedup", serial.Seconds()/max(parallel.Seconds(), 1e-9),
+			)
 		} else {
-			mhalfCount += 1
+			missing = falseNegatives(f, keys)
+		}
+		if cfg.Negatives > 0 {
+			// negatives go through the same -hash-seed as the inserted keys
+			fps[i] = fpReport(f.fil, len(set), bloomKeys(NegativeIds(set, cfg.Negatives)))
+		}
+		slog.Info(
+			"confirm",
+			"filter", f.name,
+			"n", f.n,
+			"m", f.fil.Cap(),
+			"k", f.fil.K(),
+			"bloom_approx", f.fil.ApproximatedSize(),
+			"bloom_bytes", f.fil.BitSet().BinaryStorageSize(),
+			"hits", len(keys)-len(missing),
+			"misses", len(missing),
+			"fp", fps[i],
+		)
+		// an under-sized filter shows what happens past capacity
+		if cfg.Negatives > 0 && f.n < uint(len(keys)) && fps[i].MeasuredRate > cfg.FP {
+			slog.Warn(
+				"under-sized filter exceeded its target false positive rate",
+				"filter", f.name,
+				"n", f.n,
+				"entries", len(keys),
+				"target_rate", cfg.FP,
+				"measured_rate", fps[i].MeasuredRate,
+			)
 		}
-	}
 
-	log.Println(fmt.Sprintf("Hits in bloom: %d, Miss in bloom: %d, Half in: %d, Half miss: %d", hitCount, missCount, halfCoount, mhalfCount))
+		if len(missing) == 0 {
+			continue
+		}
+		if cfg.state.timedOut || cfg.state.truncated {
+			// the passes stopped at different points, misses are expected
+			slog.Warn("false negatives after a partial pass", "filter", f.name, "misses", len(missing))
+			continue
+		}
+		for _, id := range missing[:min(len(missing), 10)] {
+			slog.Error("false negative", "filter", f.name, "id", id)
+		}
+		err = errors.Join(err, fmt.Errorf("%d false negatives in the %s filter", len(missing), f.name))
+	}
+	return fps, err
 }
 
 func main() {
 
 	enableTracing := flag.Bool("e", true, "Enable Tracing files for profiling with runtime/trace")
-	ctx := context.TODO()
+	bucketBy := flag.String("bucket", "", "Bucket events into per hour|day bloom filters by created_at")
+	bucketCap := flag.Uint("bucket-cap", 12000, "Upper bound on the capacity of each bucket bloom filter, each is sized from its share of -n")
+	queryBucket := flag.String("query-bucket", "", "Bucket to query after ingestion e.g 2015-01-01T15 or 2015-01-01")
+	queryId := flag.String("query-id", "", "Event id to look up in -query-bucket")
+	workers := flag.Int("workers", 0, "Process entries concurrently into a locked bloom with this many workers")
+	buffer := flag.Int("buffer", 64, "Bounded channel size between the decoder and the workers")
+	presize := flag.Bool("presize", false, "Compare an un-hinted map against one pre-sized with make(map, N)")
+	input := flag.String("input", LARGE_JSON_FILE, "URL, s3://bucket/key or local file of the json events, optionally gzipped")
+	onlyNew := flag.String("only-new", "", "Saved bloom used as a seen baseline, counts and adds ids it does not contain")
+	negatives := flag.Int("negatives", 10000, "Size of the generated negative set used to measure false positives")
+	halfRatio := flag.Float64("half-ratio", 0.5, "Capacity of the under-sized filter as a fraction of N")
+	authBearer := flag.String("auth-bearer", "", "Bearer token sent when fetching -input over http")
+	authBasic := flag.String("auth-basic", "", "user:pass sent as basic auth when fetching -input over http")
+	jsonImpl := flag.String("json-impl", "stdlib", "JSON decoder to use, or all to compare every built in decoder on the input")
+	types := flag.Bool("types", false, "List the distinct event types in the input and exit")
+	format := flag.String("format", FORMAT_ARRAY, "Input layout: array for a json array of events or ndjson for one event per line")
+	lineBuffer := flag.Int("line-buffer", 1<<20, "Longest ndjson line in bytes")
+	compact := flag.Bool("compact", false, "Rebuild the map sized to its final length after ingestion and report the saving")
+	sorted := flag.Bool("sorted", false, "Also build a sorted slice set and compare lookups across map, bloom and slice")
+	cpuProfile := flag.String("cpuprofile", "", "Write a cpu profile labelled by stage to this file")
+	decodeLatency := flag.Bool("decode-latency", false, "Report p50, p99 and max time per decoded entry for every pass")
+	allowPartial := flag.Bool("allow-partial", false, "Keep the entries decoded before a truncated input ends instead of failing")
+	maxDuration := flag.Duration("max-duration", 0, "Stop each pass over the input after this long and report the partial results")
+	regionOverhead := flag.Bool("region-overhead", false, "Measure the cost of trace.WithRegion around a streaming pass, needs -e")
+	var headers headerFlags
+	flag.Var(&headers, "header", "Extra \"Key: Value\" request header for http inputs, repeatable")
+	reuse := flag.Bool("reuse", false, "Compare reallocating against clear()/ClearAll reuse over -iterations")
+	iterations := flag.Int("iterations", 5, "Iterations for repeated measurements")
+	targetCV := flag.Float64("target-cv", 0, "Keep repeating measurements past -iterations until the coefficient of variation of their time drops below this, 0 for exactly -iterations")
+	maxIterations := flag.Int("max-iterations", 100, "Stop a -target-cv measurement after this many iterations even if it has not converged")
+	version := flag.Bool("version", false, "Print build information and exit")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	logJSON := flag.Bool("log-json", false, "Log as json instead of text")
+	n := flag.Uint("n", BLOOM_N, "Expected push events the filters are sized for")
+	fp := flag.Float64("fp", 0, fmt.Sprintf("False positive rate the filters are sized for, %v unless -bloom-m and -bloom-k fix it", BLOOM_FP))
+	manifest := flag.String("manifest", "", "Json file listing config overrides, one compare run per entry")
+	csvOut := flag.String("csv", "", "Append one row per compare run to this csv file")
+	arrayKey := flag.String("array-key", "events", "Field holding the events when the array input is wrapped in an object")
+	filterSpec := flag.String("filters", FILTER_BOTH, "Filters to build: full, half, both or a comma separated list of those and capacities e.g full,3000,24000")
+	cache := flag.String("cache", "", "Download http inputs once into this directory, resuming interrupted downloads")
+	outDirFlag := flag.String("outdir", ".", "Directory the map, filter and checkpoint artifacts are written to and reloaded from")
+	refreshCache := flag.Bool("refresh-cache", false, "Download a cached http input again when the server reports it changed")
+	retries := flag.Int("retries", 3, "Attempts at downloading an http input into -cache")
+	key := flag.String("key", "id", "Event field used as the membership key: id, actor.login, repo.name or payload.head")
+	serve := flag.String("serve", "", "After the compare run keep serving GET /test?id=&filter= and /stats from the filters on this address e.g :8080")
+	quiet := flag.Bool("quiet", false, "Only log errors, the result on stdout is unaffected")
+	output := flag.String("output", OUTPUT_TABLE, "Result written to stdout after a compare run: table, json, csv or none")
+	retained := flag.Bool("retained", false, "Build the map and the bloom one at a time, measuring the heap before, with and after dropping each")
+	ghArchive := flag.String("gharchive", "", "Read the gharchive.org hour YYYY-MM-DD-H, or a FROM..TO range of hours run through -novelty, instead of -input")
+	jsonPath := flag.String("jsonpath", "", "Use the value at this dot separated path e.g payload.commits.0.sha as the key instead of -key")
+	openSet := flag.Bool("openset", false, "Build the map, an open addressing set of xxhash key hashes and the bloom one at a time and compare their memory and insert time")
+	approxEvery := flag.Int("approx-every", 0, "Sample every filter's estimated distinct count every this many inserts and compare it with the map's exact count")
+	bloomPretest := flag.Bool("bloom-pretest", false, "Test each key before adding it to a filter and compare the duplicates the filters see with the map's")
+	listenSocket := flag.String("listen-socket", "", "Read the input from the first connection to this unix socket instead of -input")
+	transformOut := flag.String("transform-out", "", "Write every event the key includes as a json line to this file during the bloom pass")
+	metricsFile := flag.String("metrics-file", "", "Write the compare run's result as OpenMetrics text to this file at the end, e.g a .prom file for the node exporter's textfile collector")
+	adversarial := flag.Bool("adversarial", false, "Insert -n random, sequential, shared prefix, last bytes only and hash colliding keys into a map and a bloom and compare the measured fp with the theoretical one, then exit")
+	checkpoint := flag.Duration("checkpoint-interval", 0, "Save the map pass's map to "+CHECKPOINT_MAP_FILE+" and the bloom pass's filters to "+CHECKPOINT_FILE+" this often so a crashed run can -resume")
+	resume := flag.Bool("resume", false, "Load "+CHECKPOINT_MAP_FILE+" and "+CHECKPOINT_FILE+" and continue each pass after the entries they hold, under the same -hash-seed")
+	orderCheck := flag.String("order-check", "", "Comma separated worker counts e.g 1,2,4,8, fill the locked and the merged worker blooms once per count and fail unless each matches a serial fill bit for bit")
+	diffFilters := flag.String("diff-filters", "", "Load two saved bloom gobs, a.gob,b.gob, report how many bits differ and exit non-zero unless none do")
+	hashSeed := flag.Uint64("hash-seed", 0, "Pre-hash keys with xxhash64 under this seed before the compare run's filters see them, the same seed and input give the same bits, 0 to add keys as they are")
+	s3Endpoint := flag.String("s3-endpoint", "", "Endpoint for s3://bucket/key inputs e.g http://localhost:9000, default the AWS_REGION endpoint of aws")
+	baseline := flag.String("baseline", "", "Json result of an earlier compare run, exit non-zero when this run's time, alloc or bytes grew past -baseline-threshold")
+	updateBaseline := flag.Bool("update-baseline", false, "Write this run's result to -baseline instead of comparing against it")
+	baselinePct := flag.Float64("baseline-threshold", 10, "Percent a -baseline metric may grow before the run fails")
+	verify := flag.Bool("verify-artifacts", false, "Reload the map and filters a compare run saved to -outdir into a fresh state, confirm them and exit")
+	gzipLevelFlag := flag.Int("gzip-level", gzip.DefaultCompression, "Gzip level of the saved artifacts, 1 (fastest) to 9 (smallest) or -1 for the default")
+	typeFilters := flag.Bool("type-filters", false, "Build a map and a bloom of -key per event type and report each type's share of the memory, -output json also writes it to stdout")
+	sparkline := flag.Int("sparkline", 0, "Sample the live heap every this many entries of the map and bloom passes and draw both after the result table, each sample forces a gc")
+	exportJSON := flag.String("export-json", "", "Write the first filter as a json m, k and base64 bits descriptor other languages can rebuild, see descriptor.go")
+	dumpIds := flag.String("dump-ids", "", "Write every inserted key, one per line, to this file")
+	lru := flag.Int("lru", 0, "Compare a bloom against an exact lru set holding this many recent keys")
+	queryCount := flag.Int("query-count", 0, "After building, time this many lookups against the map and every filter")
+	queryHitRatio := flag.Float64("query-hit-ratio", 0.5, "Fraction of -query-count lookups for keys that are present")
+	memLimit := flag.Int64("mem-limit", 0, "Soft memory limit in MB, in-memory passes that would cross it fail instead of being oom killed")
+	maxInMemory := flag.Int64("max-inmemory-bytes", 4<<30, "Refuse to read an input larger than this into memory, 0 for no limit")
+	inMemory := flag.Bool("in-memory", false, "Read the whole input into memory before decoding instead of streaming it")
+	confirmWorkers := flag.Int("confirm-workers", 0, "Goroutines testing map keys against each filter in the confirm phase and timing it against the serial pass, 0 for the serial pass only")
+	overfill := flag.Bool("overfill", false, "Fill a filter sized for -n to 0.5x, 1x, 2x and 4x n and write the measured false positive rates as csv, appended to -csv when set")
+	normalize := flag.Bool("normalize", false, "Lowercase and trim keys before inserting and looking them up")
+	bloomM := flag.Uint("bloom-m", 0, "Pin the bits of the full filter, with -bloom-k, instead of deriving them from -n and -fp")
+	bloomK := flag.Uint("bloom-k", 0, "Pin the hash count of the full filter, with -bloom-m")
+	fpCost := flag.Duration("fp-cost", 0, "Sweep fp rates charging this much per exact check behind the bloom and report the wasted work")
+	explain := flag.Bool("explain", false, "Print how -n and -fp size the filters and exit")
+	novelty := flag.String("novelty", "", "Comma separated inputs in timeline order, report the fraction of each step's ids not seen in the earlier steps")
+	processors := flag.String("processors", "", "Run these accumulators in one pass and compare them e.g map,bloom,cuckoo,hll,openset,quotient")
+	commits := flag.Bool("commits", false, "Insert every push commit sha into a map and a bloom sized by -n and -fp and compare duplicate counts")
+	flag.Usage = envUsage
+	if err := parseArgs(os.Args[1:]); err != nil {
+		log.Fatalf("Invalid arguments: %v", err)
+	}
+	if err := applyEnv(); err != nil {
+		log.Fatalf("Invalid environment: %v", err)
+	}
 
-	var (
-		m1, m2, m3 runtime.MemStats
-	)
+	if *version {
+		fmt.Println(ReadBuildInfo())
+		return
+	}
+	ctx := context.TODO()
 
 	cfg := &Config{
 		TracingEnabled: *enableTracing,
 		TraceFile:      TRACE_FILE,
+		BucketBy:       *bucketBy,
+		BucketCap:      *bucketCap,
+		QueryBucket:    *queryBucket,
+		QueryId:        *queryId,
+		Workers:        *workers,
+		Buffer:         *buffer,
+		Presize:        *presize,
+		Input:          *input,
+		OnlyNew:        *onlyNew,
+		Negatives:      *negatives,
+		HalfRatio:      *halfRatio,
+		AuthBearer:     *authBearer,
+		AuthBasic:      *authBasic,
+		JSONImpl:       *jsonImpl,
+		Types:          *types,
+		Format:         *format,
+		LineBuffer:     *lineBuffer,
+		Compact:        *compact,
+		Sorted:         *sorted,
+		CPUProfile:     *cpuProfile,
+		MaxDuration:    *maxDuration,
+		RegionOverhead: *regionOverhead,
+		Headers:        headers,
+		Reuse:          *reuse,
+		Iterations:     *iterations,
+		LogLevel:       *logLevel,
+		LogJSON:        *logJSON,
+		N:              *n,
+		FP:             *fp,
+		Manifest:       *manifest,
+		CSV:            *csvOut,
+		ArrayKey:       *arrayKey,
+		Commits:        *commits,
+		Filters:        *filterSpec,
+		Cache:          *cache,
+		Retries:        *retries,
+		Key:            *key,
+		Serve:          *serve,
+		DumpIds:        *dumpIds,
+		LRU:            *lru,
+		QueryCount:     *queryCount,
+		QueryHitRatio:  *queryHitRatio,
+		MemLimit:       *memLimit,
+		ConfirmWorkers: *confirmWorkers,
+		Overfill:       *overfill,
+		Normalize:      *normalize,
+		BloomM:         *bloomM,
+		BloomK:         *bloomK,
+		FPCost:         *fpCost,
+		Explain:        *explain,
+		Novelty:        *novelty,
+		Processors:     *processors,
+		RefreshCache:   *refreshCache,
+		AllowPartial:   *allowPartial,
+		DecodeLatency:  *decodeLatency,
+		TransformOut:   *transformOut,
+		ListenSocket:   *listenSocket,
+		BloomPretest:   *bloomPretest,
+		GHArchive:      *ghArchive,
+		Retained:       *retained,
+		Quiet:          *quiet,
+		Output:         *output,
+		MaxInMemory:    *maxInMemory,
+		ApproxEvery:    *approxEvery,
+		OpenSet:        *openSet,
+		JSONPath:       *jsonPath,
+		TargetCV:       *targetCV,
+		MaxIterations:  *maxIterations,
+		ExportJSON:     *exportJSON,
+		Sparkline:      *sparkline,
+		TypeFilters:    *typeFilters,
+		GzipLevel:      *gzipLevelFlag,
+		OutDir:         *outDirFlag,
+		Verify:         *verify,
+		Baseline:       *baseline,
+		UpdateBaseline: *updateBaseline,
+		BaselinePct:    *baselinePct,
+		S3Endpoint:     *s3Endpoint,
+		HashSeed:       *hashSeed,
+		DiffFilters:    *diffFilters,
+		OrderCheck:     *orderCheck,
+		Checkpoint:     *checkpoint,
+		Resume:         *resume,
+		Adversarial:    *adversarial,
+		MetricsFile:    *metricsFile,
+		InMemory:       *inMemory,
+	}
+
+	setupLogging(cfg)
+
+	cfg.resolveFP()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid flags: %s", strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	gzipLevel = cfg.GzipLevel
+	if err := setupOutDir(cfg); err != nil {
+		log.Fatalf("Error creating -outdir: %v", err)
+	}
+	resolveS3(cfg)
+	setupHashSeed(cfg)
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if cfg.GHArchive != "" {
+		if explicit["input"] || explicit["novelty"] {
+			log.Fatalf("-gharchive picks the input, drop -input and -novelty")
+		}
+		urls, err := ghArchiveURLs(cfg.GHArchive)
+		if err != nil {
+			log.Fatalf("bad -gharchive: %v", err)
+		}
+		// the archive is one event per line
+		if !explicit["format"] {
+			cfg.Format = FORMAT_NDJSON
+		}
+		if len(urls) == 1 {
+			cfg.Input = urls[0]
+		} else {
+			cfg.Novelty = strings.Join(urls, ",")
+		}
+		slog.Info("gharchive", "hours", len(urls), "first", urls[0], "last", urls[len(urls)-1])
+	}
+	if cfg.BloomM > 0 {
+		slog.Info("pinned filter", "m", cfg.BloomM, "k", cfg.BloomK, "n", cfg.N, "fp", cfg.FP)
 	}
+	setupTokenizer(cfg)
+	setupKey(cfg)
+	setupMemLimit(cfg)
 
 	closer := setupTracing(cfg)
 	defer closer()
+	profCloser := setupCPUProfile(cfg)
+	defer profCloser()
 
+	slog.Info("build", "info", ReadBuildInfo())
+
+	if cfg.Manifest != "" {
+		RunManifest(ctx, cfg)
+		return
+	}
+
+	if cfg.DiffFilters != "" {
+		RunDiffFilters(cfg)
+		return
+	}
+
+	if cfg.Verify {
+		RunVerifyArtifacts(cfg)
+		return
+	}
+
+	if cfg.Explain {
+		Explain(os.Stdout, cfg)
+		return
+	}
+
+	if cfg.Overfill {
+		RunOverfill(cfg)
+		return
+	}
+
+	if cfg.Adversarial {
+		RunAdversarial(cfg)
+		return
+	}
+
+	if cfg.JSONImpl == JSON_IMPL_ALL {
+		RunJSONCompare(ctx, cfg)
+		return
+	}
+
+	if cfg.RegionOverhead {
+		RunRegionOverhead(ctx, cfg)
+		return
+	}
+
+	if cfg.Reuse {
+		RunReuse(ctx, cfg)
+		return
+	}
+
+	if cfg.Types {
+		RunTypes(ctx, cfg)
+		return
+	}
+
+	if cfg.TypeFilters {
+		RunTypeFilters(ctx, cfg)
+		return
+	}
+
+	if cfg.Commits {
+		RunCommits(ctx, cfg)
+		return
+	}
+
+	if cfg.Retained {
+		RunRetained(ctx, cfg)
+		return
+	}
+
+	if cfg.OpenSet {
+		RunOpenSet(ctx, cfg)
+		return
+	}
+
+	if cfg.ListenSocket != "" {
+		RunSocket(ctx, cfg)
+		return
+	}
+
+	if cfg.Processors != "" {
+		RunProcessors(ctx, cfg)
+		return
+	}
+
+	if cfg.Novelty != "" {
+		RunNovelty(ctx, cfg)
+		return
+	}
+
+	if cfg.FPCost > 0 {
+		RunFPCost(ctx, cfg)
+		return
+	}
+
+	if cfg.LRU != 0 {
+		RunLRU(ctx, cfg)
+		return
+	}
+
+	if cfg.OnlyNew != "" {
+		RunOnlyNew(ctx, cfg)
+		return
+	}
+
+	if cfg.BucketBy != "" {
+		RunBuckets(ctx, cfg)
+		return
+	}
+
+	if cfg.OrderCheck != "" {
+		RunOrderCheck(ctx, cfg)
+		return
+	}
+
+	if cfg.Workers > 0 {
+		RunConcurrent(ctx, cfg)
+		return
+	}
+
+	if cfg.Presize {
+		RunPresize(ctx, cfg)
+		return
+	}
+
+	if cfg.CSV != "" {
+		if err := CheckCSV(cfg.CSV, resultColumns); err != nil {
+			log.Fatalf("Error checking csv: %v", err)
+		}
+	}
+	res, err := RunCompare(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Error in the compare run: %v", err)
+	}
+	if cfg.CSV != "" {
+		AppendCSV(cfg.CSV, res)
+	}
+	// logs go to stderr, stdout only ever carries the result
+	switch cfg.Output {
+	case OUTPUT_TABLE:
+		// kept off when the result already went elsewhere
+		if cfg.CSV == "" && !cfg.LogJSON {
+			res.Table(os.Stdout)
+		}
+	case OUTPUT_JSON:
+		err = res.WriteJSON(os.Stdout)
+	case OUTPUT_CSV:
+		err = res.WriteCSV(os.Stdout, true)
+	}
+	if err != nil {
+		log.Fatalf("Error writing the result: %v", err)
+	}
+	if cfg.MetricsFile != "" {
+		if err := WriteMetricsFile(cfg.MetricsFile, res); err != nil {
+			log.Fatalf("Error writing -metrics-file: %v", err)
+		}
+		slog.Info("metrics written", "file", cfg.MetricsFile)
+	}
+	if cfg.Baseline != "" {
+		RunBaseline(cfg, res)
+	}
+	if cfg.Serve != "" {
+		Serve(ctx, cfg, res.filters)
+	}
+}
+
+// the default run: stream the input into the map then the filters, save
+// them and confirm the filters against the map
+func RunCompare(ctx context.Context, cfg *Config) (*Result, error) {
+	// a config run twice starts over
+	cfg.state = runState{}
+	var m1, m2, m3 runtime.MemStats
+	var mapInsert, bloomInsert time.Duration
+
+	// bloom bit sets are allocated up front, outside the measured stages.
+	// the heap before them is where the bloom's retained bytes start
+	base := settledHeap()
+	var fils []*Filter
+	var err error
+	bloomConstruct := timeIt(func() {
+		fils, err = newFilters(cfg)
+	})
+	if err != nil {
+		log.Fatalf("bad -filters %q: %v", cfg.Filters, err)
+	}
+	built := settledHeap()
+
+	// collected before and after the map stage so the heap difference is
+	// what the map retains rather than decoding garbage
+	runtime.GC()
 	runtime.ReadMemStats(&m1)
-	ReadAllStreaming(ctx, cfg, ProcessChunkUsingMap)
+	// an empty map allocates nothing worth timing, its growth is part of
+	// the insert time
+	mp := NewMapProcessor(cfg.keyFunc, 0)
+	read, stage := ReadAllStreaming, "streaming"
+	if cfg.InMemory {
+		read, stage = ReadAllInMemory, "in-memory"
+	}
+	mapProc := timeProc(mp.Process, &mapInsert)
+	var mapCheckpointer *Checkpointer
+	if cfg.Checkpoint > 0 || cfg.Resume {
+		mapCheckpointer = NewMapCheckpointer(cfg, mp)
+		if cfg.Resume {
+			if err := mapCheckpointer.Resume(); err != nil {
+				log.Fatalf("Error resuming checkpoint: %v", err)
+			}
+		}
+		// inside the checksum so a resumed run still sums every key
+		mapProc = mapCheckpointer.Wrap(mapProc)
+	}
+	// summed outside timeProc so hashing does not count as map insert time
+	checksum := NewKeyChecksum(cfg.keyFunc)
+	mapProc = checksum.Wrap(mapProc)
+	var sampler *ApproxSampler
+	if cfg.ApproxEvery > 0 {
+		sampler = NewApproxSampler(cfg.ApproxEvery, cfg.keyFunc, mp, fils)
+		mapProc = sampler.WrapMap(mapProc)
+	}
+	var mapGrowth, bloomGrowth *HeapSampler
+	if cfg.Sparkline > 0 {
+		mapGrowth = NewHeapSampler(cfg.Sparkline)
+		mapProc = mapGrowth.Wrap(mapProc)
+	}
+	Stage(ctx, stage+"-map", func(ctx context.Context) {
+		err = read(ctx, cfg, wrappedProcessor{mp, mapProc})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if cfg.Checkpoint > 0 {
+		// the whole map, a crash in the bloom pass resumes after it
+		if err := mapCheckpointer.Save(); err != nil {
+			log.Fatalf("Error saving checkpoint: %v", err)
+		}
+	}
+	slog.Info("dataset", "key", cfg.Key, "checksum", checksum.String())
+	runtime.ReadMemStats(&m2)
+	memUsage("map", fils, &m1, &m2)
+	mapGC, mapPause := gcDelta(&m1, &m2)
+	mapAlloc, mapHeap := deltaMB(m1.Alloc, m2.Alloc), deltaMB(m1.HeapAlloc, m2.HeapAlloc)
+	mapMallocs, _, mapLive := objectDelta(&m1, &m2)
+	slog.Info(
+		"duplicates",
+		"key", cfg.Key,
+		"inserts", mp.inserts,
+		"distinct", len(mp.set),
+		"duplicates", mp.Duplicates(),
+		"duplicate_rate", float64(mp.Duplicates())/float64(max(mp.inserts, 1)),
+	)
+	if cfg.Compact {
+		CompactMapProcessor(mp)
+	}
+	set := mp.set
+	settledHeap()
 	runtime.ReadMemStats(&m2)
-	memUsage(&m1, &m2)
-	ReadAllStreaming(ctx, cfg, ProcessChunkUsingBloom)
+	mapRetained := int64(m2.HeapAlloc) - int64(m1.HeapAlloc)
+	fp := NewFiltersProcessor(cfg.keyFunc, fils, cfg.BloomPretest)
+	bloomProc := timeProc(fp.Process, &bloomInsert)
+	if sampler != nil {
+		bloomProc = sampler.WrapBloom(bloomProc)
+	}
+	var transform *TransformWriter
+	if cfg.TransformOut != "" {
+		// written during the bloom pass, its alloc_mb includes the encoding
+		if transform, err = NewTransformWriter(cfg.TransformOut, cfg.keyFunc); err != nil {
+			log.Fatalf("Error creating -transform-out: %v", err)
+		}
+		bloomProc = transform.Wrap(bloomProc)
+	}
+	if cfg.Sparkline > 0 {
+		bloomGrowth = NewHeapSampler(cfg.Sparkline)
+		bloomProc = bloomGrowth.Wrap(bloomProc)
+	}
+	var checkpointer *Checkpointer
+	if cfg.Checkpoint > 0 || cfg.Resume {
+		checkpointer = NewCheckpointer(cfg, fils)
+		if cfg.Resume {
+			if err := checkpointer.Resume(); err != nil {
+				log.Fatalf("Error resuming checkpoint: %v", err)
+			}
+		}
+		// outermost so resumed entries are neither timed nor sampled
+		bloomProc = checkpointer.Wrap(bloomProc)
+	}
+	Stage(ctx, stage+"-bloom", func(ctx context.Context) {
+		err = read(ctx, cfg, wrappedProcessor{fp, bloomProc})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	if checkpointer != nil {
+		mapCheckpointer.Done()
+		checkpointer.Done()
+	}
+	if transform != nil {
+		if err := transform.Close(); err != nil {
+			log.Fatalf("Error writing -transform-out: %v", err)
+		}
+		slog.Info("transform out", "file", cfg.TransformOut, "count", transform.count)
+	}
 	// memory consumption can actually reduce causing an overflow
 	runtime.ReadMemStats(&m3)
-	memUsage(&m2, &m3)
+	memUsage("bloom", fils, &m2, &m3)
+	bloomGC, bloomPause := gcDelta(&m2, &m3)
+	bloomMallocs, _, bloomLive := objectDelta(&m2, &m3)
+	// measured like the map's: the heap the filters hold once garbage is
+	// gone, their construction plus whatever the pass left alive
+	bloomRetained := built - base + settledHeap() - int64(m2.HeapAlloc)
 
-	blomBytes, err := blomfil.GobEncode()
-	if err != nil {
-		log.Fatalf("Error on gob Marshal: %v", err)
+	slog.Info("timing", "mode", "map", "insert_ms", mapInsert.Milliseconds())
+	slog.Info("timing", "mode", "bloom", "construct_ms", bloomConstruct.Milliseconds(), "insert_ms", bloomInsert.Milliseconds())
+	if cfg.BloomPretest {
+		reportPretest(fils, mp.Duplicates(), len(set))
+	}
+	if sampler != nil {
+		sampler.Report()
 	}
 
-	halfblomBytes, err := halfblomfil.GobEncode()
-	if err != nil {
-		log.Fatalf("Error on gob Marshal: %v", err)
+	if cfg.Normalize {
+		reportNormalized(ctx, cfg, len(set))
+	}
+
+	if cfg.Sorted {
+		compareLookups(RunSortedStage(ctx, cfg), set, fils[0])
+	}
+	if cfg.QueryCount > 0 {
+		RunQueryWorkload(cfg, set, fils)
 	}
 
 	var buf bytes.Buffer
 	gobenc := gob.NewEncoder(&buf)
-	err = gobenc.Encode(pushEventMap)
+	mapEncode := timeIt(func() { err = gobenc.Encode(set) })
 	if err != nil {
 		log.Fatalf("Error on json Marshal: %v", err)
 	}
 
-	Save("mapBytes.gob", buf.Bytes())
-	Save("bloomBytes.gob", blomBytes)
-	Save("halfbloomBytes.gob", halfblomBytes)
-	Confirm()
+	entries := len(set)
+	mapGobBytes := buf.Len()
+	slog.Info("map gob", "gob_bytes", mapGobBytes, "bytes_per_entry", float64(mapGobBytes)/float64(max(entries, 1)))
+	mapSave := timeIt(func() {
+		err = SaveArtifact(artifactPath("mapBytes.gob"), NewArtifactHeader(cfg, "map", 0, 0, entries), buf.Bytes())
+	})
+	if err != nil {
+		log.Fatalf("Error saving map artifact: %v", err)
+	}
+	slog.Info("persist", "artifact", "map", "encode_us", mapEncode.Microseconds(), "save_us", mapSave.Microseconds())
+	for _, f := range fils {
+		var blomBytes []byte
+		f.encode = timeIt(func() { blomBytes, err = f.fil.GobEncode() })
+		if err != nil {
+			log.Fatalf("Error on gob Marshal: %v", err)
+		}
+		hdr := NewArtifactHeader(cfg, "bloom", f.n, cfg.FP, entries)
+		hdr.Approx = f.fil.ApproximatedSize()
+		f.save = timeIt(func() { err = SaveArtifact(f.File(), hdr, blomBytes) })
+		if err != nil {
+			log.Fatalf("Error saving bloom artifact: %v", err)
+		}
+		slog.Info("persist", "artifact", f.name, "encode_us", f.encode.Microseconds(), "save_us", f.save.Microseconds())
+	}
+	if cfg.DumpIds != "" {
+		if err := DumpIds(cfg.DumpIds, set); err != nil {
+			log.Fatalf("Error dumping ids: %v", err)
+		}
+		slog.Info("dumped ids", "file", cfg.DumpIds, "count", len(set))
+	}
+	loadedMap, err := LoadMap(artifactPath("mapBytes.gob"))
+	if err != nil {
+		log.Fatalf("Error loading map artifact: %v", err)
+	}
+	slog.Info("artifact round trip", "artifact", "map", "equal", maps.Equal(loadedMap, set))
+	inserted := bloomKeys(keysOf(set))
+	for _, f := range fils {
+		loadedBloom, err := LoadBloom(f.File())
+		if err != nil {
+			log.Fatalf("Error loading bloom artifact: %v", err)
+		}
+		slog.Info("artifact round trip", "artifact", f.name, "equal", loadedBloom.Equal(f.fil))
+
+		if err := SaveRaw(f.RawFile(), f.fil); err != nil {
+			log.Fatalf("Error saving raw bit set: %v", err)
+		}
+		rawfil, err := LoadRaw(f.RawFile())
+		if err != nil {
+			log.Fatalf("Error loading raw bit set: %v", err)
+		}
+		slog.Info("raw bit set round trip", "filter", f.name, "equal", rawfil.Equal(f.fil), "hits", TestMany(rawfil, inserted), "count", len(inserted))
+	}
+	// one descriptor file, the first filter
+	blomfil := fils[0].fil
+	if cfg.ExportJSON != "" {
+		if err := SaveDescriptor(cfg.ExportJSON, NewBloomDescriptor(blomfil, inserted)); err != nil {
+			log.Fatalf("Error writing -export-json: %v", err)
+		}
+		jsonfil, err := LoadDescriptor(cfg.ExportJSON)
+		if err != nil {
+			log.Fatalf("Error reading back -export-json: %v", err)
+		}
+		slog.Info("json descriptor round trip", "file", cfg.ExportJSON, "equal", jsonfil.Equal(blomfil))
+	}
+	fps, confirmErr := Confirm(cfg, set, fils)
+
+	res := &Result{
+		Input:          redactedInput(cfg),
+		N:              cfg.N,
+		FP:             cfg.FP,
+		HalfRatio:      cfg.HalfRatio,
+		Entries:        entries,
+		MapInsert:      mapInsert,
+		BloomConstruct: bloomConstruct,
+		BloomInsert:    bloomInsert,
+		MapAllocMB:     mapAlloc,
+		BloomAllocMB:   deltaMB(m2.Alloc, m3.Alloc),
+		MapHeapMB:      mapHeap,
+		BloomHeapMB:    deltaMB(m2.HeapAlloc, m3.HeapAlloc),
+		MapAlloc:       int64(m2.Alloc) - int64(m1.Alloc),
+		BloomAlloc:     int64(m3.Alloc) - int64(m2.Alloc),
+		MapHeap:        int64(m2.HeapAlloc) - int64(m1.HeapAlloc),
+		BloomHeap:      int64(m3.HeapAlloc) - int64(m2.HeapAlloc),
+		MapMallocs:     mapMallocs,
+		MapLive:        mapLive,
+		BloomMallocs:   bloomMallocs,
+		BloomLive:      bloomLive,
+		MapRetained:    mapRetained,
+		BloomRetained:  bloomRetained,
+		MapGobBytes:    mapGobBytes,
+		Duplicates:     mp.Duplicates(),
+		Checksum:       checksum.String(),
+		BloomBytes:     filterBytes(fils),
+		MapNumGC:       mapGC,
+		MapGCPause:     mapPause,
+		BloomNumGC:     bloomGC,
+		BloomGCPause:   bloomPause,
+		MapEncode:      mapEncode,
+		MapSave:        mapSave,
+		Filters:        make([]FilterResult, len(fils)),
+		Status:         "completed",
+		Build:          ReadBuildInfo(),
+		filters:        fils,
+	}
+	for i, f := range fils {
+		res.Filters[i] = FilterResult{
+			Name:       f.name,
+			N:          f.n,
+			Approx:     f.fil.ApproximatedSize(),
+			Bytes:      f.fil.BitSet().BinaryStorageSize(),
+			MeasuredFP: fps[i].MeasuredRate,
+			Encode:     f.encode,
+			Save:       f.save,
+		}
+		res.BloomEncode += f.encode
+		res.BloomSave += f.save
+	}
+	if res.Half = NewHalfReport(res); res.Half != nil {
+		res.Half.Log()
+	}
+	if cfg.Sparkline > 0 {
+		res.Growth = &HeapGrowth{Every: cfg.Sparkline, Map: mapGrowth.Samples, Bloom: bloomGrowth.Samples}
+	}
+	switch {
+	case cfg.state.memLimited:
+		res.Status = "exceeds memory limit"
+		slog.Warn("run", "status", res.Status, "mem_limit", humanBytes(uint64(cfg.MemLimit)*1000000), "max_inmemory", humanBytes(uint64(cfg.MaxInMemory)))
+	case cfg.state.timedOut:
+		// each pass had its own deadline so they may have seen different entries
+		res.Status = "timed out"
+		slog.Warn("run", "status", res.Status, "max_duration", cfg.MaxDuration)
+	case cfg.state.truncated:
+		res.Status = "truncated"
+		slog.Warn("run", "status", res.Status)
+	default:
+		slog.Info("run", "status", res.Status)
+	}
+	if confirmErr != nil {
+		res.Status = "failed"
+	}
+	return res, confirmErr
 }
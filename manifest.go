@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// where manifest results go when -csv is not set
+const MANIFEST_CSV = "results.csv"
+
+// a manifest is a json array of objects. each object overrides fields of the
+// config built from the flags, named as in Config e.g.
+//
+//	[{"Input": "events.json.gz", "N": 12000, "FP": 0.01}, {"HalfRatio": 0.25}]
+func LoadManifest(filename string, base *Config) ([]Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	cfgs := make([]Config, len(entries))
+	for i, raw := range entries {
+		cfgs[i] = *base
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		// a misspelt field would otherwise silently run the defaults
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfgs[i]); err != nil {
+			return nil, err
+		}
+		cfgs[i].Manifest = ""
+		// a pinned filter's fp follows the entry's m, k and n unless the
+		// entry names one itself
+		if cfgs[i].BloomM > 0 && !namesField(raw, "FP") {
+			cfgs[i].FP = 0
+		}
+		cfgs[i].resolveFP()
+		if err := cfgs[i].Validate(); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+	}
+	return cfgs, nil
+}
+
+// whether the entry sets field, matched without case like the decoder does
+func namesField(raw json.RawMessage, field string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	for name := range fields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func RunManifest(ctx context.Context, cfg *Config) {
+	cfgs, err := LoadManifest(cfg.Manifest, cfg)
+	if err != nil {
+		log.Fatalf("Error loading manifest %s: %v", cfg.Manifest, err)
+	}
+	out := cfg.CSV
+	if out == "" {
+		out = MANIFEST_CSV
+	}
+	// before any run rather than after the first
+	if err := CheckCSV(out, resultColumns); err != nil {
+		log.Fatalf("Error checking csv: %v", err)
+	}
+
+	for i := range cfgs {
+		run := &cfgs[i]
+		setupTokenizer(run)
+		setupKey(run)
+		gzipLevel = run.GzipLevel
+		if err := setupOutDir(run); err != nil {
+			log.Fatalf("Error creating -outdir: %v", err)
+		}
+		resolveS3(run)
+		setupHashSeed(run)
+		slog.Info("manifest run", "run", i+1, "of", len(cfgs), "input", redactedInput(run), "n", run.N, "fp", run.FP)
+		res, err := RunCompare(ctx, run)
+		if err != nil {
+			// keep going, the row records the failure
+			slog.Error("manifest run failed", "run", i+1, "err", err)
+		}
+		// an input that could not be read leaves nothing to record
+		if res == nil {
+			continue
+		}
+		AppendCSV(out, res)
+	}
+	slog.Info("manifest", "runs", len(cfgs), "csv", out)
+}
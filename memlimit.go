@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// how often the in-memory reader samples memory, ReadMemStats stops the world
+const MEM_CHECK_EVERY = 4 << 20
+
+var errMemLimit = errors.New("would exceed memory limit")
+
+var errTooLarge = errors.New("input too large to read into memory, use streaming mode")
+
+// the limit is soft, the gc works harder near it but still lets the heap
+// through. the in-memory readers check it themselves so they fail cleanly
+// where streaming, which holds one entry at a time, carries on
+func setupMemLimit(cfg *Config) {
+	if cfg.MemLimit > 0 {
+		debug.SetMemoryLimit(cfg.MemLimit * 1000000)
+	}
+}
+
+// what the runtime counts against the limit
+func runtimeMemory() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys - m.HeapReleased
+}
+
+// fails a read into memory before it would cross limit. io.ReadAll grows its
+// buffer by about what it holds so the next growth needs read bytes more
+type memGuardReader struct {
+	r         io.Reader
+	limit     uint64
+	read      uint64
+	nextCheck uint64
+}
+
+func (g *memGuardReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.read += uint64(n)
+	if g.read >= g.nextCheck {
+		g.nextCheck = g.read + MEM_CHECK_EVERY
+		if used := runtimeMemory(); used+g.read >= g.limit {
+			return n, fmt.Errorf("%w: %s read with %s in use, limit %s", errMemLimit, humanBytes(g.read), humanBytes(used), humanBytes(g.limit))
+		}
+	}
+	return n, err
+}
+
+// reads body into memory up to limit bytes, 0 for no limit. an announced size
+// over the limit is refused before reading anything, the cap itself holds
+// against servers that lie about or leave out the length
+func readAllCapped(body *inputBody, r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	if body.Size > limit {
+		return nil, fmt.Errorf("%w: %d bytes announced, -max-inmemory-bytes is %d", errTooLarge, body.Size, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes, the -max-inmemory-bytes limit", errTooLarge, limit)
+	}
+	return data, err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const METRICS_PREFIX = "bvm_"
+
+// one metric family of the text exposition, every sample shares its type
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels [][2]string
+	value  float64
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func (f *metricFamily) add(value float64, labels ...string) {
+	s := metricSample{value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		s.labels = append(s.labels, [2]string{labels[i], labels[i+1]})
+	}
+	f.samples = append(f.samples, s)
+}
+
+// the result as gauges, every sample labelled with the input it came from
+func (r *Result) metricFamilies() []*metricFamily {
+	gauge := func(name, help string) *metricFamily {
+		return &metricFamily{name: METRICS_PREFIX + name, help: help}
+	}
+	info := gauge("run_info", "Build and status of the run, always 1")
+	info.add(1, "status", r.Status, "version", r.Build.Version, "go", r.Build.Go, "bloom", r.Build.Bloom)
+	entries := gauge("entries", "Distinct keys inserted")
+	entries.add(float64(r.Entries))
+	dups := gauge("duplicates", "Keys the map saw again")
+	dups.add(float64(r.Duplicates))
+
+	seconds := gauge("build_seconds", "Insert time of each structure, construction included for the bloom")
+	seconds.add(r.MapInsert.Seconds(), "structure", "map")
+	seconds.add((r.BloomConstruct + r.BloomInsert).Seconds(), "structure", "bloom")
+	alloc := gauge("alloc_bytes", "Heap allocated over each structure's pass")
+	alloc.add(float64(r.MapAlloc), "structure", "map")
+	alloc.add(float64(r.BloomAlloc), "structure", "bloom")
+	retained := gauge("retained_bytes", "Heap each structure holds once built and collected")
+	retained.add(float64(r.MapRetained), "structure", "map")
+	retained.add(float64(r.BloomRetained), "structure", "bloom")
+	gcs := gauge("gc_cycles", "Collections during each structure's pass")
+	gcs.add(float64(r.MapNumGC), "structure", "map")
+	gcs.add(float64(r.BloomNumGC), "structure", "bloom")
+	pause := gauge("gc_pause_seconds", "Stop the world pauses during each structure's pass")
+	pause.add(r.MapGCPause.Seconds(), "structure", "map")
+	pause.add(r.BloomGCPause.Seconds(), "structure", "bloom")
+	encode := gauge("encode_seconds", "GobEncode time of each saved artifact")
+	encode.add(r.MapEncode.Seconds(), "artifact", "map")
+	save := gauge("save_seconds", "Save time of each artifact")
+	save.add(r.MapSave.Seconds(), "artifact", "map")
+
+	capacity := gauge("filter_capacity", "Entries each filter was sized for")
+	bytes := gauge("filter_bytes", "Bit set bytes of each filter")
+	approx := gauge("filter_approx_entries", "Distinct entries each filter estimates it holds")
+	fp := gauge("filter_false_positive_rate", "False positive rate measured against generated negatives")
+	for _, f := range r.Filters {
+		capacity.add(float64(f.N), "filter", f.Name)
+		bytes.add(float64(f.Bytes), "filter", f.Name)
+		approx.add(float64(f.Approx), "filter", f.Name)
+		fp.add(f.MeasuredFP, "filter", f.Name)
+		encode.add(f.Encode.Seconds(), "artifact", f.Name)
+		save.add(f.Save.Seconds(), "artifact", f.Name)
+	}
+	written := gauge("result_timestamp_seconds", "When the metrics were written")
+	written.add(float64(time.Now().Unix()))
+
+	return []*metricFamily{
+		info, entries, dups, seconds, alloc, retained, gcs, pause, encode, save,
+		capacity, bytes, approx, fp, written,
+	}
+}
+
+// OpenMetrics text, which the prometheus text parsers of a pushgateway or
+// the node exporter's textfile collector also read
+func (r *Result) WriteOpenMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.metricFamilies() {
+		fmt.Fprintf(bw, "# TYPE %s gauge\n# HELP %s %s\n", f.name, f.name, f.help)
+		for _, s := range f.samples {
+			bw.WriteString(f.name)
+			bw.WriteString(`{input="` + escapeLabel(r.Input) + `"`)
+			for _, l := range s.labels {
+				bw.WriteString(`,` + l[0] + `="` + escapeLabel(l[1]) + `"`)
+			}
+			bw.WriteString("} " + strconv.FormatFloat(s.value, 'f', -1, 64) + "\n")
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// through a temp file and a rename, a collector never reads half a file
+func WriteMetricsFile(filename string, r *Result) error {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := r.WriteOpenMetrics(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
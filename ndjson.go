@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+const (
+	FORMAT_ARRAY  = "array"
+	FORMAT_NDJSON = "ndjson"
+	FORMAT_TAR    = "tar"
+)
+
+// decodes one model per line. push events with many commits easily outgrow
+// the scanner's 64KB default so the line limit is configurable
+func decodeLines(ctx context.Context, r io.Reader, maxLine int, proc func(*Model)) (count int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(maxLine, bufio.MaxScanTokenSize)), maxLine)
+
+	line := 0
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		default:
+		}
+		line += 1
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		m := Model{}
+		src := &endReader{r: bytes.NewReader(raw)}
+		if err := timedDecode(NewTokenizer(src), &m); err != nil {
+			// every line ends where its bytes do, only the last one can
+			// be an input cut short, one with lines after it is malformed
+			if trunc := asTruncation(err, src); errors.Is(trunc, io.ErrUnexpectedEOF) {
+				if onlyBlankLeft(scanner) {
+					return count, fmt.Errorf("line %d: %w", line, trunc)
+				}
+				return count, fmt.Errorf("line %d: %v", line, err)
+			}
+			return count, fmt.Errorf("line %d: %w", line, err)
+		}
+		proc(&m)
+		count += 1
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return count, fmt.Errorf("line %d is longer than -line-buffer %d bytes: %w", line+1, maxLine, err)
+		}
+		return count, err
+	}
+	return count, nil
+}
+
+// consumes the rest of the input, true when it holds no further entry. a
+// reader that itself ended early, like a cut short archive member, holds
+// none either
+func onlyBlankLeft(scanner *bufio.Scanner) bool {
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			return false
+		}
+	}
+	err := scanner.Err()
+	return err == nil || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// picks the decoder for the configured input format, archives are
+// recognised by name
+func decodeInput(ctx context.Context, cfg *Config, r io.Reader, proc func(*Model)) (int, error) {
+	format := cfg.Format
+	if isTarName(cfg.Input) {
+		format = FORMAT_TAR
+	}
+	switch format {
+	case FORMAT_NDJSON:
+		return decodeLines(ctx, r, cfg.LineBuffer, proc)
+	case FORMAT_ARRAY, "":
+		return decodeStream(ctx, r, cfg.ArrayKey, proc)
+	case FORMAT_TAR:
+		return decodeTar(ctx, cfg, r, proc)
+	}
+	log.Fatalf("unknown -format %q, want %s, %s or %s", cfg.Format, FORMAT_ARRAY, FORMAT_NDJSON, FORMAT_TAR)
+	return 0, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// a push with enough commits to outgrow the scanner's 64KB default
+func longLine() []byte {
+	commit := `{"message": "` + strings.Repeat("m", 400) + `"}`
+	commits := strings.Repeat(commit+",", 399) + commit
+	return []byte(`{"id": "long", "type": "PushEvent", "payload": {"commits": [` + commits + "]}}\n")
+}
+
+func TestDecodeLinesLongLine(t *testing.T) {
+	line := longLine()
+	if len(line) <= bufio.MaxScanTokenSize {
+		t.Fatalf("line of %d bytes fits the default buffer", len(line))
+	}
+	data := append(encodeEvents(t, testEvents(3), FORMAT_NDJSON), line...)
+
+	count, err := decodeLines(context.Background(), bytes.NewReader(data), 1<<20, func(*Model) {})
+	if err != nil || count != 4 {
+		t.Fatalf("decoded %d entries, err %v, want 4 and no error", count, err)
+	}
+
+	count, err = decodeLines(context.Background(), bytes.NewReader(data), len(line)/2, func(*Model) {})
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("got %v, want bufio.ErrTooLong", err)
+	}
+	if !strings.Contains(err.Error(), "line 4") || !strings.Contains(err.Error(), "-line-buffer") {
+		t.Fatalf("error %q does not name the line and -line-buffer", err)
+	}
+	if count != 3 {
+		t.Fatalf("decoded %d entries before the long line, want 3", count)
+	}
+}
+
+func TestDecodeLinesBlank(t *testing.T) {
+	data := []byte("\n{\"id\": \"1\"}\n\n  \n{\"id\": \"2\"}")
+	count, err := decodeLines(context.Background(), bytes.NewReader(data), 1<<20, func(*Model) {})
+	if err != nil || count != 2 {
+		t.Fatalf("decoded %d entries, err %v, want 2 and no error", count, err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// streaming dedup across a timeline. every input, e.g consecutive hours,
+// gets its own filter which is merged into the running union once the step
+// is done, so the novelty of a step is measured only against the steps
+// before it. the exact map gives the true curve alongside the estimate
+func RunNovelty(ctx context.Context, cfg *Config) {
+	inputs := strings.Split(cfg.Novelty, ",")
+	// the union has to hold every step, all filters share its m and k so
+	// they can be merged
+	m, k := bloom.EstimateParameters(cfg.N*uint(len(inputs)), cfg.FP)
+	seenBloom := bloom.New(m, k)
+	seenMap := map[string]bool{}
+
+	for i, input := range inputs {
+		step := *cfg
+		step.Input = strings.TrimSpace(input)
+
+		ids := map[string]bool{}
+		for _, id := range collectIds(ctx, &step) {
+			ids[id] = true
+		}
+
+		fil := bloom.New(m, k)
+		var bloomNew, mapNew int
+		for id := range ids {
+			fil.AddString(id)
+			if !seenBloom.TestString(id) {
+				bloomNew += 1
+			}
+			if !seenMap[id] {
+				mapNew += 1
+			}
+		}
+		if err := seenBloom.Merge(fil); err != nil {
+			slog.Error("merging step filter", "step", i+1, "err", err)
+			return
+		}
+		for id := range ids {
+			seenMap[id] = true
+		}
+
+		// a false positive against the earlier steps hides a new id, so the
+		// bloom can only under count novelty
+		slog.Info(
+			"novelty",
+			"step", i+1,
+			"input", redactedInput(&step),
+			"distinct", len(ids),
+			"bloom_novelty", float64(bloomNew)/float64(max(len(ids), 1)),
+			"map_novelty", float64(mapNew)/float64(max(len(ids), 1)),
+			"hidden", mapNew-bloomNew,
+			"seen_total", len(seenMap),
+			"seen_approx", seenBloom.ApproximatedSize(),
+		)
+	}
+	slog.Info("novelty union", "m", m, "k", k, "bloom_bytes", seenBloom.BitSet().BinaryStorageSize(), "fp_at_end", fpFor(m, k, len(seenMap)))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// grown past this so probe runs stay short
+	OPENSET_MAX_LOAD = 0.75
+	// probe lengths from here on share the last bucket
+	OPENSET_PROBE_BUCKETS = 8
+)
+
+// exact set of 64 bit key hashes with linear probing. no buckets, pointers
+// or key strings, just a slice. two keys sharing a hash collide, with 64 bits
+// that is expected once in about 2^32 keys
+type OpenSet struct {
+	slots []uint64
+	mask  uint64
+	count int
+}
+
+// sized so n keys fit under the max load without growing
+func NewOpenSet(n int) *OpenSet {
+	size := 8
+	for float64(n) > OPENSET_MAX_LOAD*float64(size) {
+		size *= 2
+	}
+	return &OpenSet{slots: make([]uint64, size), mask: uint64(size - 1)}
+}
+
+// zero marks an empty slot so no key may hash to it
+func openSetHash(key string) uint64 {
+	if h := xxhash.Sum64String(key); h != 0 {
+		return h
+	}
+	return 1
+}
+
+// the slot holding h or the empty slot ending its probe run
+func (s *OpenSet) find(h uint64) uint64 {
+	i := h & s.mask
+	for s.slots[i] != 0 && s.slots[i] != h {
+		i = (i + 1) & s.mask
+	}
+	return i
+}
+
+func (s *OpenSet) insert(h uint64) bool {
+	i := s.find(h)
+	if s.slots[i] == h {
+		return false
+	}
+	s.slots[i] = h
+	s.count += 1
+	return true
+}
+
+func (s *OpenSet) grow() {
+	old := s.slots
+	s.slots = make([]uint64, 2*len(old))
+	s.mask = uint64(len(s.slots) - 1)
+	s.count = 0
+	for _, h := range old {
+		if h != 0 {
+			s.insert(h)
+		}
+	}
+}
+
+// reports whether key was new
+func (s *OpenSet) AddString(key string) bool {
+	if float64(s.count+1) > OPENSET_MAX_LOAD*float64(len(s.slots)) {
+		s.grow()
+	}
+	return s.insert(openSetHash(key))
+}
+
+func (s *OpenSet) TestString(key string) bool {
+	h := openSetHash(key)
+	return s.slots[s.find(h)] == h
+}
+
+func (s *OpenSet) Len() int {
+	return s.count
+}
+
+func (s *OpenSet) Load() float64 {
+	return float64(s.count) / float64(len(s.slots))
+}
+
+func (s *OpenSet) Bytes() int {
+	return len(s.slots) * 8
+}
+
+// how far every stored hash sits from its home slot, the extra slots a hit
+// on it reads. the last bucket holds every distance from it on
+func (s *OpenSet) ProbeLengths() []int {
+	hist := make([]int, OPENSET_PROBE_BUCKETS)
+	for i, h := range s.slots {
+		if h == 0 {
+			continue
+		}
+		dist := (uint64(i) - h) & s.mask
+		hist[min(dist, OPENSET_PROBE_BUCKETS-1)] += 1
+	}
+	return hist
+}
+
+type OpenSetProcessor struct {
+	key     KeyFunc
+	set     *OpenSet
+	inserts int
+}
+
+func NewOpenSetProcessor(key KeyFunc, n uint) *OpenSetProcessor {
+	return &OpenSetProcessor{key: key, set: NewOpenSet(int(n))}
+}
+
+func (p *OpenSetProcessor) Process(md *Model) {
+	if key, ok := p.key(md); ok {
+		p.set.AddString(key)
+		p.inserts += 1
+	}
+}
+
+func (p *OpenSetProcessor) TestString(key string) bool {
+	return p.set.TestString(key)
+}
+
+func (p *OpenSetProcessor) Report() ProcessorReport {
+	return ProcessorReport{Name: "openset", Inserts: p.inserts, Distinct: uint64(p.set.Len()), Bytes: p.set.Bytes()}
+}
+
+func reportOpenSet(set *OpenSet) {
+	hist := set.ProbeLengths()
+	total, mean := 0, 0.0
+	for dist, count := range hist {
+		total += count
+		mean += float64(dist * count)
+	}
+	slog.Info(
+		"openset",
+		"distinct", set.Len(),
+		"slots", len(set.slots),
+		"load", set.Load(),
+		"bytes", set.Bytes(),
+		"bytes_per_entry", float64(set.Bytes())/float64(max(set.Len(), 1)),
+		// a lower bound, the last bucket is counted at its start
+		"mean_probe", mean/float64(max(total, 1)),
+	)
+	for dist, count := range hist {
+		label := slog.Int("probe", dist)
+		if dist == OPENSET_PROBE_BUCKETS-1 {
+			label = slog.String("probe", fmt.Sprintf(">=%d", dist))
+		}
+		slog.Info("openset probes", label, slog.Int("count", count), slog.Float64("pct", 100*float64(count)/float64(max(total, 1))))
+	}
+}
+
+// the map, the open addressing set and the bloom each built alone, so the
+// retained heap is theirs, with the time spent inserting. the set starts
+// sized for -n and grows past it like the map does
+func RunOpenSet(ctx context.Context, cfg *Config) {
+	timed := func(ctx context.Context, insert func(string)) time.Duration {
+		var elapsed time.Duration
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(timeProc(func(md *Model) {
+			if key, ok := cfg.keyFunc(md); ok {
+				insert(key)
+			}
+		}, &elapsed))); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+		return elapsed
+	}
+	var elapsed time.Duration
+	var inserts int
+
+	measureRetained(ctx, "map", func(ctx context.Context) any {
+		m := map[string]bool{}
+		elapsed = timed(ctx, func(key string) {
+			m[key] = true
+			inserts += 1
+		})
+		return m
+	})
+	slog.Info("timing", "mode", "map", "insert_ms", elapsed.Milliseconds(), "ns_per_insert", elapsed.Nanoseconds()/int64(max(inserts, 1)))
+
+	measureRetained(ctx, "openset", func(ctx context.Context) any {
+		set := NewOpenSet(int(cfg.N))
+		elapsed = timed(ctx, func(key string) { set.AddString(key) })
+		// reported before the drop, the report's garbage is collected first
+		reportOpenSet(set)
+		return set
+	})
+	slog.Info("timing", "mode", "openset", "insert_ms", elapsed.Milliseconds(), "ns_per_insert", elapsed.Nanoseconds()/int64(max(inserts, 1)))
+
+	measureRetained(ctx, "bloom", func(ctx context.Context) any {
+		fil := bloom.NewWithEstimates(cfg.N, cfg.FP)
+		elapsed = timed(ctx, func(key string) { fil.AddString(key) })
+		return fil
+	})
+	slog.Info("timing", "mode", "bloom", "insert_ms", elapsed.Milliseconds(), "ns_per_insert", elapsed.Nanoseconds()/int64(max(inserts, 1)))
+}
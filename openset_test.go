@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+// started far too small it grows several times on the way, every key it
+// took survives each rehash and nothing it never took is found
+func TestOpenSetExactAcrossGrowth(t *testing.T) {
+	s := NewOpenSet(10)
+	initial := len(s.slots)
+	keys := syntheticIds(5000, "key-")
+	for _, key := range keys {
+		if !s.AddString(key) {
+			t.Fatalf("%q reported as already present", key)
+		}
+	}
+	for _, key := range keys[:100] {
+		if s.AddString(key) {
+			t.Fatalf("%q added twice", key)
+		}
+	}
+	if len(s.slots) <= initial {
+		t.Fatalf("still %d slots after %d keys", len(s.slots), len(keys))
+	}
+	if s.Len() != len(keys) {
+		t.Fatalf("holds %d keys, added %d", s.Len(), len(keys))
+	}
+	if s.Load() > OPENSET_MAX_LOAD {
+		t.Fatalf("load %.3f past the max of %.2f", s.Load(), OPENSET_MAX_LOAD)
+	}
+	present := map[string]bool{}
+	for _, key := range keys {
+		present[key] = true
+		if !s.TestString(key) {
+			t.Fatalf("added %q then lost it", key)
+		}
+	}
+	for _, key := range NegativeIds(present, 20000) {
+		if s.TestString(key) {
+			t.Fatalf("%q found but never added", key)
+		}
+	}
+	total := 0
+	for _, c := range s.ProbeLengths() {
+		total += c
+	}
+	if total != s.Len() {
+		t.Fatalf("probe lengths cover %d keys, holds %d", total, s.Len())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// comma separated positive worker counts e.g 1,2,4,8
+func parseWorkerCounts(spec string) ([]int, error) {
+	var counts []int
+	for _, part := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("worker count %q must be a positive integer", part)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
+
+// a bloom only ever sets bits, so whichever order the workers happen to
+// add keys in the filled bit set must be the serial one. for every
+// -order-check count the locked bloom and the merged worker blooms are
+// filled through the fan out and compared bit for bit against a serial fill
+func RunOrderCheck(ctx context.Context, cfg *Config) {
+	counts, err := parseWorkerCounts(cfg.OrderCheck)
+	if err != nil {
+		log.Fatalf("bad -order-check: %v", err)
+	}
+
+	serial := bloom.NewWithEstimates(cfg.N, cfg.FP)
+	Stage(ctx, "order-serial", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			if key, ok := cfg.keyFunc(md); ok {
+				serial.AddString(key)
+			}
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+
+	diverged := 0
+	compare := func(mode string, workers int, fil *bloom.BloomFilter) {
+		diff, err := diffBits(serial, fil)
+		if err != nil {
+			log.Fatalf("Error comparing %s with %d workers: %v", mode, workers, err)
+		}
+		if diff > 0 {
+			diverged += 1
+			slog.Error("order check diverged", "mode", mode, "workers", workers, "differing_bits", diff)
+			return
+		}
+		slog.Info("order check", "mode", mode, "workers", workers, "bits_set", fil.BitSet().Count(), "equal", true)
+	}
+	for _, workers := range counts {
+		run := *cfg
+		run.Workers = workers
+		seen := map[string]bool{}
+
+		safe := NewSafeBloom(cfg.N, cfg.FP)
+		safeProcs := make([]func(*Model), workers)
+		for i := range safeProcs {
+			safeProcs[i] = func(md *Model) {
+				if key, ok := cfg.keyFunc(md); ok {
+					safe.AddString(key)
+				}
+			}
+		}
+		runFanOut(ctx, &run, "safe-bloom", safeProcs, seen)
+		compare("safe-bloom", workers, safe.fil)
+
+		fils, procs := workerBlooms(&run)
+		runFanOut(ctx, &run, "merged-bloom", procs, seen)
+		compare("merged-bloom", workers, mergeBlooms(fils))
+	}
+
+	slog.Info("order check done", "worker_counts", counts, "runs", 2*len(counts), "diverged", diverged, "bits_set", serial.BitSet().Count())
+	if diverged > 0 {
+		log.Fatalf("%d of %d concurrent fills diverged from the serial bit set", diverged, 2*len(counts))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// multiples of the design n inserted by -overfill
+var overfillLoads = []float64{0.5, 1, 2, 4}
+
+func syntheticIds(n int, prefix string) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return ids
+}
+
+var overfillColumns = []string{"load_factor", "inserted", "m", "k", "measured_fp", "theoretical_fp", "target_fp"}
+
+// fills a filter sized for -n and -fp to each load factor with synthetic
+// ids and measures the false positive rate, showing how accuracy collapses
+// past capacity. rows are appended to -csv like every other mode's, or
+// written to stdout without it
+func RunOverfill(cfg *Config) {
+	if cfg.CSV != "" {
+		if err := CheckCSV(cfg.CSV, overfillColumns); err != nil {
+			log.Fatalf("Error checking csv %s: %v", cfg.CSV, err)
+		}
+	}
+	var rows [][]string
+	for _, load := range overfillLoads {
+		fil := bloom.NewWithEstimates(cfg.N, cfg.FP)
+		present := map[string]bool{}
+		for _, id := range syntheticIds(int(load*float64(cfg.N)), "id-") {
+			fil.AddString(id)
+			present[id] = true
+		}
+		report := measureFP(fil, present, cfg.Negatives)
+		slog.Info("overfill", "load_factor", load, "inserted", len(present), "fp", report)
+		rows = append(rows, []string{
+			strconv.FormatFloat(load, 'g', -1, 64),
+			strconv.Itoa(len(present)),
+			strconv.FormatUint(uint64(fil.Cap()), 10),
+			strconv.FormatUint(uint64(fil.K()), 10),
+			strconv.FormatFloat(report.MeasuredRate, 'g', -1, 64),
+			strconv.FormatFloat(report.TheoreticalRate, 'g', -1, 64),
+			strconv.FormatFloat(cfg.FP, 'g', -1, 64),
+		})
+	}
+
+	var err error
+	if cfg.CSV != "" {
+		err = AppendRows(cfg.CSV, overfillColumns, rows...)
+	} else {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(overfillColumns)
+		err = w.WriteAll(rows)
+	}
+	if err != nil {
+		log.Fatalf("Error writing overfill csv: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// builds the map with a size hint, 0 being the default growth from empty
+func mapStage(ctx context.Context, cfg *Config, hint int) {
+	var m1, m2 runtime.MemStats
+	var insert time.Duration
+
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+	mp := NewMapProcessor(cfg.keyFunc, hint)
+	Stage(ctx, "presize-map", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, timedProcessor{mp, &insert}); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+	runtime.ReadMemStats(&m2)
+
+	slog.Info(
+		"presize",
+		"mode", "map",
+		"hint", hint,
+		"count", len(mp.set),
+		"elapsed_ms", insert.Milliseconds(),
+		"mallocs", m2.Mallocs-m1.Mallocs,
+		"total", humanDelta(m1.TotalAlloc, m2.TotalAlloc),
+	)
+}
+
+func RunPresize(ctx context.Context, cfg *Config) {
+	mapStage(ctx, cfg, 0)
+	mapStage(ctx, cfg, int(cfg.N))
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// an accumulator fed one decoded entry at a time. the readers drive a list
+// of them so several share a single pass over the input, each keeping its
+// own state
+type Processor interface {
+	Process(*Model)
+	Report() ProcessorReport
+}
+
+// a bare func as a Processor, for passes that only collect or count. it
+// holds nothing of its own to report
+type ProcessFunc func(*Model)
+
+func (f ProcessFunc) Process(md *Model) {
+	f(md)
+}
+
+func (f ProcessFunc) Report() ProcessorReport {
+	return ProcessorReport{}
+}
+
+// reports p while proc, p.Process behind timing or sampling wrappers, does
+// the processing
+type wrappedProcessor struct {
+	Processor
+	proc func(*Model)
+}
+
+func (p wrappedProcessor) Process(md *Model) {
+	p.proc(md)
+}
+
+// what a reader calls for each entry, a single processor as is
+func drive(procs []Processor) func(*Model) {
+	if len(procs) == 1 {
+		return procs[0].Process
+	}
+	return func(md *Model) {
+		for _, p := range procs {
+			p.Process(md)
+		}
+	}
+}
+
+// processors that can answer membership, the fp of the others is not defined
+type Tester interface {
+	TestString(string) bool
+}
+
+// what a processor holds once the pass is done
+type ProcessorReport struct {
+	Name    string
+	Inserts int
+	// exact for the map, estimated by everything else
+	Distinct uint64
+	Bytes    int
+	// inserts a full structure turned away
+	Rejected int
+}
+
+// exact set, the reference the others are checked against. hint presizes
+// it, 0 grows it from empty
+type MapProcessor struct {
+	key      KeyFunc
+	set      map[string]bool
+	inserts  int
+	keyBytes int
+}
+
+func NewMapProcessor(key KeyFunc, hint int) *MapProcessor {
+	return &MapProcessor{key: key, set: make(map[string]bool, hint)}
+}
+
+func (p *MapProcessor) Process(md *Model) {
+	key, ok := p.key(md)
+	if !ok {
+		return
+	}
+	p.inserts += 1
+	// a length check instead of a lookup keeps the timed insert as is
+	before := len(p.set)
+	p.set[key] = true
+	if len(p.set) > before {
+		p.keyBytes += len(key)
+	}
+}
+
+func (p *MapProcessor) TestString(key string) bool {
+	return p.set[key]
+}
+
+// inserts that found their key already present
+func (p *MapProcessor) Duplicates() int {
+	return p.inserts - len(p.set)
+}
+
+// a shared pass cannot attribute heap growth to one processor, the key bytes
+// are a lower bound that leaves out the buckets
+func (p *MapProcessor) Report() ProcessorReport {
+	return ProcessorReport{Name: "map", Inserts: p.inserts, Distinct: uint64(len(p.set)), Bytes: p.keyBytes}
+}
+
+type BloomProcessor struct {
+	key     KeyFunc
+	fil     *bloom.BloomFilter
+	inserts int
+}
+
+func NewBloomProcessor(key KeyFunc, n uint, fp float64) *BloomProcessor {
+	return &BloomProcessor{key: key, fil: bloom.NewWithEstimates(n, fp)}
+}
+
+func (p *BloomProcessor) Process(md *Model) {
+	if key, ok := p.key(md); ok {
+		p.fil.AddString(key)
+		p.inserts += 1
+	}
+}
+
+func (p *BloomProcessor) TestString(key string) bool {
+	return p.fil.TestString(key)
+}
+
+func (p *BloomProcessor) Report() ProcessorReport {
+	return ProcessorReport{Name: "bloom", Inserts: p.inserts, Distinct: uint64(p.fil.ApproximatedSize()), Bytes: p.fil.BitSet().BinaryStorageSize()}
+}
+
+// builds the processors named in spec e.g map,bloom,cuckoo,hll,openset,quotient
+func newProcessors(cfg *Config, spec string) ([]Processor, error) {
+	var procs []Processor
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "map":
+			procs = append(procs, NewMapProcessor(cfg.keyFunc, 0))
+		case "bloom":
+			procs = append(procs, NewBloomProcessor(cfg.keyFunc, cfg.N, cfg.FP))
+		case "cuckoo":
+			procs = append(procs, NewCuckooProcessor(cfg.keyFunc, cfg.N))
+		case "hll":
+			procs = append(procs, NewHLLProcessor(cfg.keyFunc, HLL_PRECISION))
+		case "openset":
+			procs = append(procs, NewOpenSetProcessor(cfg.keyFunc, cfg.N))
+		case "quotient":
+			procs = append(procs, NewQuotientProcessor(cfg.keyFunc, cfg.N, cfg.FP))
+		default:
+			return nil, fmt.Errorf("unknown processor %q, want map, bloom, cuckoo, hll, openset or quotient", name)
+		}
+	}
+	return procs, nil
+}
+
+// times Process of the processor it wraps, leaving out fetching and decoding
+type timedProcessor struct {
+	Processor
+	elapsed *time.Duration
+}
+
+func (p timedProcessor) Process(md *Model) {
+	start := time.Now()
+	p.Processor.Process(md)
+	*p.elapsed += time.Since(start)
+}
+
+// one pass over the input into every -processors accumulator. the compare
+// run keeps its separate passes, sharing one here makes the stages' memory
+// inseparable
+func RunProcessors(ctx context.Context, cfg *Config) {
+	procs, err := newProcessors(cfg, cfg.Processors)
+	if err != nil {
+		slog.Error("processors", "err", err)
+		return
+	}
+	// the exact count and the negatives come from a map, one is added when
+	// it was not asked for
+	var exact *MapProcessor
+	for _, p := range procs {
+		if m, ok := p.(*MapProcessor); ok {
+			exact = m
+		}
+	}
+	all := procs
+	if exact == nil {
+		exact = NewMapProcessor(cfg.keyFunc, 0)
+		all = append(all, exact)
+	}
+
+	elapsed := make([]time.Duration, len(all))
+	timed := make([]Processor, len(all))
+	for i, p := range all {
+		timed[i] = timedProcessor{p, &elapsed[i]}
+	}
+	Stage(ctx, "processors", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, timed...); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+
+	distinct := len(exact.set)
+	present := keysOf(exact.set)
+	negatives := NegativeIds(exact.set, cfg.Negatives)
+	lookups := map[string]LookupReport{}
+	for i, p := range procs {
+		r := p.Report()
+		args := []any{
+			"processor", r.Name,
+			"inserts", r.Inserts,
+			"distinct", r.Distinct,
+			"distinct_error_pct", 100 * (float64(r.Distinct) - float64(distinct)) / float64(max(distinct, 1)),
+			"bytes", r.Bytes,
+			"rejected", r.Rejected,
+			"process_ms", elapsed[i].Milliseconds(),
+		}
+		if t, ok := p.(Tester); ok {
+			l := measureLookups(t, present, negatives)
+			l.Bytes = r.Bytes
+			lookups[r.Name] = l
+			args = append(args, "fp", l.FP, "false_negatives", l.FalseNegatives, "hit_ns", l.HitNs, "miss_ns", l.MissNs)
+		}
+		slog.Info("processor", args...)
+	}
+	for _, name := range []string{"cuckoo", "quotient"} {
+		if other, ok := lookups[name]; ok {
+			if bl, ok := lookups["bloom"]; ok {
+				compareWithBloom(name, other, bl)
+			}
+		}
+	}
+}
+
+// what a Tester costs to ask, over the inserted keys and the negatives
+type LookupReport struct {
+	Bytes          int
+	FP             float64
+	FalseNegatives int
+	HitNs          float64
+	MissNs         float64
+}
+
+func measureLookups(t Tester, present, negatives []string) LookupReport {
+	var l LookupReport
+	hits := timeIt(func() {
+		for _, id := range present {
+			if !t.TestString(id) {
+				l.FalseNegatives += 1
+			}
+		}
+	})
+	positives := 0
+	misses := timeIt(func() {
+		for _, id := range negatives {
+			if t.TestString(id) {
+				positives += 1
+			}
+		}
+	})
+	l.FP = float64(positives) / float64(max(len(negatives), 1))
+	l.HitNs = float64(hits.Nanoseconds()) / float64(max(len(present), 1))
+	l.MissNs = float64(misses.Nanoseconds()) / float64(max(len(negatives), 1))
+	return l
+}
+
+// ratios against the bloom of the same pass, under 1 is the other
+// structure winning
+func compareWithBloom(name string, other, bl LookupReport) {
+	ratio := func(a, b float64) float64 { return a / max(b, 1e-12) }
+	axes := []struct {
+		axis  string
+		ratio float64
+	}{
+		{"bytes", ratio(float64(other.Bytes), float64(bl.Bytes))},
+		{"fp", ratio(other.FP, bl.FP)},
+		{"hit_ns", ratio(other.HitNs, bl.HitNs)},
+		{"miss_ns", ratio(other.MissNs, bl.MissNs)},
+	}
+	args := []any{"filter", name}
+	var wins, losses []string
+	for _, a := range axes {
+		args = append(args, a.axis+"_ratio", a.ratio)
+		if a.ratio < 1 {
+			wins = append(wins, a.axis)
+		} else if a.ratio > 1 {
+			losses = append(losses, a.axis)
+		}
+	}
+	args = append(args, "wins", strings.Join(wins, ","), "loses", strings.Join(losses, ","))
+	slog.Info("versus bloom", args...)
+}
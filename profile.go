@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// call and defer after
+func setupCPUProfile(cfg *Config) func() {
+	if cfg.CPUProfile == "" {
+		return func() {}
+	}
+
+	f, err := os.Create(cfg.CPUProfile)
+	if err != nil {
+		log.Fatalf("failed to create cpu profile: %v", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		log.Fatalf("failed to start cpu profile: %v", err)
+	}
+
+	return func() {
+		pprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			log.Fatalf("failed to close cpu profile: %v", err)
+		}
+	}
+}
+
+// labels fn, and goroutines it starts, with stage=name so profile samples
+// from the map and bloom passes can be told apart
+func Stage(ctx context.Context, name string, fn func(context.Context)) {
+	pprof.Do(ctx, pprof.Labels("stage", name), fn)
+}
+
+// user log events at the end of a pass, inside its region, so the trace
+// viewer shows how much data the region covered and what it held
+func traceEntries(ctx context.Context, count int, procs []Processor) {
+	if !trace.IsEnabled() {
+		return
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	trace.Log(ctx, "entries", strconv.Itoa(count))
+	for _, p := range procs {
+		// a bare ProcessFunc has nothing to say
+		if r := p.Report(); r.Name != "" {
+			trace.Log(ctx, "distinct", r.Name+"="+strconv.FormatUint(r.Distinct, 10))
+		}
+	}
+	trace.Log(ctx, "heap_alloc_bytes", strconv.FormatUint(m.HeapAlloc, 10))
+	trace.Log(ctx, "live_objects", strconv.FormatUint(m.Mallocs-m.Frees, 10))
+}
+
+// alternates plain and region wrapped decodes with tracing on so the only
+// difference between them is trace.WithRegion. the input is read into
+// memory first, a download in the timed passes would drown the overhead
+func RunRegionOverhead(ctx context.Context, cfg *Config) {
+	if !trace.IsEnabled() {
+		log.Fatalf("-region-overhead needs tracing, run with -e")
+	}
+	body := fetch(ctx, cfg)
+	jsonBytes, err := readAllCapped(body, body, cfg.MaxInMemory)
+	body.Close()
+	if err != nil {
+		log.Fatalf("Error reading all data into memory: %v", err)
+	}
+
+	const rounds = 3
+	var plain, wrapped time.Duration
+	fil := bloom.NewWithEstimates(cfg.N, cfg.FP)
+	proc := func(md *Model) {
+		if key, ok := cfg.keyFunc(md); ok {
+			fil.AddString(key)
+		}
+	}
+	decode := func() {
+		if _, err := decodeInput(ctx, cfg, bytes.NewReader(jsonBytes), proc); err != nil {
+			log.Fatalf("Error decoding input: %v", err)
+		}
+	}
+	for i := 0; i < rounds; i++ {
+		plain += timeIt(decode)
+		wrapped += timeIt(func() {
+			trace.WithRegion(ctx, "readAllStreaming", decode)
+		})
+	}
+
+	plain /= rounds
+	wrapped /= rounds
+	slog.Info(
+		"region overhead",
+		"rounds", rounds,
+		"bytes", len(jsonBytes),
+		"plain_ms", plain.Milliseconds(),
+		"region_ms", wrapped.Milliseconds(),
+		"delta_us", (wrapped - plain).Microseconds(),
+		"delta_pct", 100*float64(wrapped-plain)/float64(plain),
+	)
+}
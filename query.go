@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+)
+
+// count lookups of which hitRatio are present keys and the rest known
+// negatives, shuffled with a fixed seed so every run queries the same order
+func queryWorkload(set map[string]bool, count int, hitRatio float64) []string {
+	present := keysOf(set)
+	sort.Strings(present)
+	hits := int(float64(count) * hitRatio)
+	if len(present) == 0 {
+		hits = 0
+	}
+
+	queries := make([]string, 0, count)
+	for i := 0; i < hits; i++ {
+		queries = append(queries, present[i%len(present)])
+	}
+	queries = append(queries, NegativeIds(set, count-hits)...)
+	rng := rand.New(rand.NewPCG(1, 2))
+	rng.Shuffle(len(queries), func(i, j int) {
+		queries[i], queries[j] = queries[j], queries[i]
+	})
+	return queries
+}
+
+// read side of the comparison, lookups/sec against the map and each filter
+func RunQueryWorkload(cfg *Config, set map[string]bool, fils []*Filter) {
+	queries := queryWorkload(set, cfg.QueryCount, cfg.QueryHitRatio)
+
+	lookups := []struct {
+		mode     string
+		contains func(string) bool
+	}{
+		{"map", func(id string) bool { return set[id] }},
+	}
+	for _, f := range fils {
+		lookups = append(lookups, struct {
+			mode     string
+			contains func(string) bool
+		}{"bloom-" + f.name, f.TestString})
+	}
+
+	for _, l := range lookups {
+		found := 0
+		elapsed := timeIt(func() {
+			for _, q := range queries {
+				if l.contains(q) {
+					found += 1
+				}
+			}
+		})
+		slog.Info(
+			"query workload",
+			"mode", l.mode,
+			"queries", len(queries),
+			"hit_ratio", cfg.QueryHitRatio,
+			"found", found,
+			"elapsed_ms", elapsed.Milliseconds(),
+			"lookups_per_sec", float64(len(queries))/elapsed.Seconds(),
+		)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	// slots filled at n, past about 0.75 runs get long and lookups slow
+	QUOTIENT_LOAD = 0.75
+	// the occupied, continuation and shifted bits of every slot
+	QUOTIENT_META_BITS = 3
+
+	qfOccupied     = 1
+	qfContinuation = 2
+	qfShifted      = 4
+)
+
+// a quotient filter (Bender et al.), a compact hash table of r bit
+// remainders over 2^q slots. the top q bits of a key's hash pick its slot,
+// the next r bits are stored, so the fp is about load * 2^-r. remainders
+// sharing a slot form a sorted run, runs pushed out of their slots form a
+// cluster and the three bits per slot are enough to find a run again.
+// lookups scan neighbouring slots instead of k scattered bits, and unlike a
+// bloom the remainders could be deleted or rehashed into a larger table.
+// it refuses inserts once all but one slot is taken
+type QuotientFilter struct {
+	q, r    uint
+	slots   uint64
+	width   uint
+	words   []uint64
+	entries uint64
+}
+
+// r from fp and q from n at QUOTIENT_LOAD. q+r is at most the 64 bits of
+// the hash and a slot with its meta bits at most a word, so a tiny fp or a
+// zero one gets the r that fits instead
+func NewQuotientFilter(n uint, fp float64) *QuotientFilter {
+	r := uint(min(max(1, math.Ceil(-math.Log2(fp))), 64-QUOTIENT_META_BITS))
+	q := uint(bits.Len64(uint64(float64(max(n, 1))/QUOTIENT_LOAD) - 1))
+	q = max(q, 1)
+	r = min(r, 64-q)
+	slots := uint64(1) << q
+	width := r + QUOTIENT_META_BITS
+	return &QuotientFilter{
+		q:     q,
+		r:     r,
+		slots: slots,
+		width: width,
+		// one spare word so a slot straddling the last boundary reads in range
+		words: make([]uint64, (slots*uint64(width)+63)/64+1),
+	}
+}
+
+// slots are width bits packed back to back
+func (f *QuotientFilter) get(i uint64) uint64 {
+	pos := i * uint64(f.width)
+	w, off := pos/64, pos%64
+	v := f.words[w] >> off
+	if off+uint64(f.width) > 64 {
+		v |= f.words[w+1] << (64 - off)
+	}
+	return v & (1<<f.width - 1)
+}
+
+func (f *QuotientFilter) set(i, v uint64) {
+	pos := i * uint64(f.width)
+	w, off := pos/64, pos%64
+	mask := uint64(1)<<f.width - 1
+	f.words[w] = f.words[w]&^(mask<<off) | v<<off
+	if off+uint64(f.width) > 64 {
+		spill := 64 - off
+		f.words[w+1] = f.words[w+1]&^(mask>>spill) | v>>spill
+	}
+}
+
+func (f *QuotientFilter) incr(i uint64) uint64 { return (i + 1) & (f.slots - 1) }
+func (f *QuotientFilter) decr(i uint64) uint64 { return (i - 1) & (f.slots - 1) }
+
+func qfEmpty(v uint64) bool { return v&(qfOccupied|qfContinuation|qfShifted) == 0 }
+
+func (f *QuotientFilter) split(key string) (uint64, uint64) {
+	h := hashKey(key)
+	return (h >> f.r) & (f.slots - 1), h & (1<<f.r - 1)
+}
+
+// where the run of quotient fq starts: back to the start of its cluster,
+// then forward one run per occupied slot until fq's
+func (f *QuotientFilter) runStart(fq uint64) uint64 {
+	b := fq
+	for f.get(b)&qfShifted != 0 {
+		b = f.decr(b)
+	}
+	s := b
+	for b != fq {
+		for {
+			s = f.incr(s)
+			if f.get(s)&qfContinuation == 0 {
+				break
+			}
+		}
+		for {
+			b = f.incr(b)
+			if f.get(b)&qfOccupied != 0 {
+				break
+			}
+		}
+	}
+	return s
+}
+
+// puts v at s and shifts everything up to the next empty slot along.
+// occupied bits belong to the slot, not the remainder, so they stay put
+func (f *QuotientFilter) insertAt(s, v uint64) {
+	for {
+		prev := f.get(s)
+		empty := qfEmpty(prev)
+		if !empty {
+			prev |= qfShifted
+			if prev&qfOccupied != 0 {
+				v |= qfOccupied
+				prev &^= qfOccupied
+			}
+		}
+		f.set(s, v)
+		if empty {
+			return
+		}
+		v = prev
+		s = f.incr(s)
+	}
+}
+
+// false when the filter is full. a remainder already in the run is a
+// duplicate and not stored twice
+func (f *QuotientFilter) AddString(key string) bool {
+	fq, fr := f.split(key)
+	// one slot stays empty, a full table has no cluster start to scan back to
+	if f.entries >= f.slots-1 {
+		return f.TestString(key)
+	}
+	head := f.get(fq)
+	entry := fr << QUOTIENT_META_BITS
+	if qfEmpty(head) {
+		f.set(fq, entry|qfOccupied)
+		f.entries += 1
+		return true
+	}
+	if head&qfOccupied == 0 {
+		f.set(fq, head|qfOccupied)
+	}
+	start := f.runStart(fq)
+	s := start
+	if head&qfOccupied != 0 {
+		// the run is sorted, find fr's place in it
+		for {
+			rem := f.get(s) >> QUOTIENT_META_BITS
+			if rem == fr {
+				return true
+			}
+			if rem > fr {
+				break
+			}
+			s = f.incr(s)
+			if f.get(s)&qfContinuation == 0 {
+				break
+			}
+		}
+		if s == start {
+			// the old head moves up and continues the run fr now starts
+			f.set(start, f.get(start)|qfContinuation)
+		} else {
+			entry |= qfContinuation
+		}
+	}
+	if s != fq {
+		entry |= qfShifted
+	}
+	f.insertAt(s, entry)
+	f.entries += 1
+	return true
+}
+
+func (f *QuotientFilter) TestString(key string) bool {
+	fq, fr := f.split(key)
+	if f.get(fq)&qfOccupied == 0 {
+		return false
+	}
+	s := f.runStart(fq)
+	for {
+		rem := f.get(s) >> QUOTIENT_META_BITS
+		if rem == fr {
+			return true
+		}
+		if rem > fr {
+			return false
+		}
+		s = f.incr(s)
+		if f.get(s)&qfContinuation == 0 {
+			return false
+		}
+	}
+}
+
+func (f *QuotientFilter) Bytes() int {
+	return int((f.slots*uint64(f.width) + 7) / 8)
+}
+
+func (f *QuotientFilter) Load() float64 {
+	return float64(f.entries) / float64(f.slots)
+}
+
+type QuotientProcessor struct {
+	key     KeyFunc
+	fil     *QuotientFilter
+	inserts int
+	failed  int
+}
+
+func NewQuotientProcessor(key KeyFunc, n uint, fp float64) *QuotientProcessor {
+	return &QuotientProcessor{key: key, fil: NewQuotientFilter(n, fp)}
+}
+
+func (p *QuotientProcessor) Process(md *Model) {
+	key, ok := p.key(md)
+	if !ok {
+		return
+	}
+	p.inserts += 1
+	if !p.fil.AddString(key) {
+		p.failed += 1
+	}
+}
+
+func (p *QuotientProcessor) TestString(key string) bool {
+	return p.fil.TestString(key)
+}
+
+func (p *QuotientProcessor) Report() ProcessorReport {
+	return ProcessorReport{Name: "quotient", Inserts: p.inserts, Distinct: p.fil.entries, Bytes: p.fil.Bytes(), Rejected: p.failed}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+// filled until it refuses inserts, no key it accepted may go missing
+// however long the runs and clusters got
+func TestQuotientNoFalseNegatives(t *testing.T) {
+	f := NewQuotientFilter(1000, 0.01)
+	var added []string
+	for _, key := range syntheticIds(3000, "key-") {
+		if f.entries >= f.slots-1 {
+			break
+		}
+		if f.AddString(key) {
+			added = append(added, key)
+		}
+	}
+	if f.Load() < 0.99 {
+		t.Fatalf("filled to a load of %.3f, want near full", f.Load())
+	}
+	for _, key := range added {
+		if !f.TestString(key) {
+			t.Fatalf("accepted %q then lost it", key)
+		}
+	}
+}
+
+// at n the measured fp stays under the fp asked for, about load * 2^-r
+func TestQuotientFP(t *testing.T) {
+	const n, fp = 5000, 0.01
+	f := NewQuotientFilter(n, fp)
+	present := map[string]bool{}
+	for _, key := range syntheticIds(n, "key-") {
+		f.AddString(key)
+		present[key] = true
+	}
+	hits := 0
+	negatives := NegativeIds(present, 50000)
+	for _, key := range negatives {
+		if f.TestString(key) {
+			hits += 1
+		}
+	}
+	if rate := float64(hits) / float64(len(negatives)); rate > fp {
+		t.Fatalf("measured fp %.4f at n, asked for %.4f", rate, fp)
+	}
+}
+
+// a slot and its meta bits fit a word and q+r the hash whatever fp asks for
+func TestQuotientClamp(t *testing.T) {
+	for _, tc := range []struct {
+		n  uint
+		fp float64
+	}{
+		{1, 1e-30},
+		{2, 0},
+		{10, 1e-30},
+		{10, 0},
+		{1 << 20, 1e-30},
+	} {
+		f := NewQuotientFilter(tc.n, tc.fp)
+		if f.width > 64 || f.q+f.r > 64 {
+			t.Fatalf("n %d fp %g: q %d r %d width %d", tc.n, tc.fp, f.q, f.r, f.width)
+		}
+		var added []string
+		for _, key := range syntheticIds(int(tc.n), "key-") {
+			if f.AddString(key) {
+				added = append(added, key)
+			}
+		}
+		for _, key := range added {
+			if !f.TestString(key) {
+				t.Fatalf("n %d fp %g: added %q and lost it", tc.n, tc.fp, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// raw bit set layout, every integer big endian:
+//
+//	[4]byte  magic "BVMB"
+//	uint64   m, bits in the filter
+//	uint64   k, hash functions
+//	uint64   bit set length in bits, equal to m
+//	[]uint64 ceil(m/64) words, bit i is (word[i/64] >> (i%64)) & 1
+//
+// locations are derived as in bits-and-blooms/bloom, murmur3 128 bit double
+// hashing, so a reader in another language must hash the same way
+var rawMagic = [4]byte{'B', 'V', 'M', 'B'}
+
+// closed once on every path, a failed close fails the save
+func SaveRaw(filename string, f *bloom.BloomFilter) (err error) {
+	fi, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := fi.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(fi)
+	if _, err := w.Write(rawMagic[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, [2]uint64{uint64(f.Cap()), uint64(f.K())}); err != nil {
+		return err
+	}
+	if _, err := f.BitSet().WriteTo(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func LoadRaw(filename string) (*bloom.BloomFilter, error) {
+	fi, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	r := bufio.NewReader(fi)
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != rawMagic {
+		return nil, fmt.Errorf("%s is not a raw bloom bit set", filename)
+	}
+	var mk [2]uint64
+	if err := binary.Read(r, binary.BigEndian, &mk); err != nil {
+		return nil, err
+	}
+	f := bloom.New(uint(mk[0]), uint(mk[1]))
+	if _, err := f.BitSet().ReadFrom(r); err != nil {
+		return nil, err
+	}
+	if uint64(f.BitSet().Len()) != mk[0] {
+		return nil, fmt.Errorf("%s: header says %d bits, bit set has %d", filename, mk[0], f.BitSet().Len())
+	}
+	return f, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type FilterResult struct {
+	Name       string        `json:"name"`
+	N          uint          `json:"n"`
+	Approx     uint32        `json:"approx"`
+	Bytes      int           `json:"bytes"`
+	MeasuredFP float64       `json:"measured_fp"`
+	Encode     time.Duration `json:"encode_ns"`
+	Save       time.Duration `json:"save_ns"`
+}
+
+// bit set bytes over the distinct keys the filter estimates it holds
+func (f FilterResult) BytesPerEntry() float64 {
+	return float64(f.Bytes) / float64(max(f.Approx, 1))
+}
+
+// one compare run, flattened into a csv row or encoded as json
+type Result struct {
+	Input          string         `json:"input"`
+	N              uint           `json:"n"`
+	FP             float64        `json:"fp"`
+	HalfRatio      float64        `json:"half_ratio"`
+	Entries        int            `json:"entries"`
+	Duplicates     int            `json:"duplicates"`
+	Checksum       string         `json:"checksum"`
+	MapInsert      time.Duration  `json:"map_insert_ns"`
+	BloomConstruct time.Duration  `json:"bloom_construct_ns"`
+	BloomInsert    time.Duration  `json:"bloom_insert_ns"`
+	MapAllocMB     int64          `json:"map_alloc_mb"`
+	BloomAllocMB   int64          `json:"bloom_alloc_mb"`
+	MapHeapMB      int64          `json:"map_heap_mb"`
+	BloomHeapMB    int64          `json:"bloom_heap_mb"`
+	MapAlloc       int64          `json:"map_alloc_bytes"`
+	BloomAlloc     int64          `json:"bloom_alloc_bytes"`
+	MapHeap        int64          `json:"map_heap_bytes"`
+	BloomHeap      int64          `json:"bloom_heap_bytes"`
+	MapMallocs     uint64         `json:"map_mallocs"`
+	MapLive        int64          `json:"map_live_objects"`
+	BloomMallocs   uint64         `json:"bloom_mallocs"`
+	BloomLive      int64          `json:"bloom_live_objects"`
+	MapRetained    int64          `json:"map_retained_bytes"`
+	BloomRetained  int64          `json:"bloom_retained_bytes"`
+	MapGobBytes    int            `json:"map_gob_bytes"`
+	BloomBytes     int            `json:"bloom_bytes"`
+	MapNumGC       uint32         `json:"map_num_gc"`
+	MapGCPause     time.Duration  `json:"map_gc_pause_ns"`
+	BloomNumGC     uint32         `json:"bloom_num_gc"`
+	BloomGCPause   time.Duration  `json:"bloom_gc_pause_ns"`
+	MapEncode      time.Duration  `json:"map_encode_ns"`
+	MapSave        time.Duration  `json:"map_save_ns"`
+	BloomEncode    time.Duration  `json:"bloom_encode_ns"`
+	BloomSave      time.Duration  `json:"bloom_save_ns"`
+	Filters        []FilterResult `json:"filters"`
+	Half           *HalfReport    `json:"half_experiment,omitempty"`
+	Status         string         `json:"status"`
+	Build          BuildInfo      `json:"build"`
+	// drawn in the table only
+	Growth *HeapGrowth `json:"-"`
+	// what -serve keeps answering from after the run
+	filters []*Filter
+}
+
+var resultColumns = []string{
+	"input", "n", "fp", "half_ratio", "entries", "duplicates", "checksum",
+	"map_insert_ms", "bloom_construct_ms", "bloom_insert_ms",
+	"map_alloc_mb", "bloom_alloc_mb", "map_heap_mb", "bloom_heap_mb",
+	"map_mallocs", "map_live_objects", "bloom_mallocs", "bloom_live_objects", "map_retained_bytes", "map_gob_bytes", "map_bytes_per_entry", "bloom_retained_bytes", "bloom_bytes",
+	"map_num_gc", "map_gc_pause_us", "bloom_num_gc", "bloom_gc_pause_us",
+	"map_encode_us", "map_save_us", "bloom_encode_us", "bloom_save_us",
+	"filters_fp", "filters_bytes_per_entry", "status", "version", "go", "bloom",
+}
+
+func (r *Result) Row() []string {
+	ms := func(d time.Duration) string { return strconv.FormatInt(d.Milliseconds(), 10) }
+	float := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	return []string{
+		r.Input,
+		strconv.FormatUint(uint64(r.N), 10),
+		float(r.FP),
+		float(r.HalfRatio),
+		strconv.Itoa(r.Entries),
+		strconv.Itoa(r.Duplicates),
+		r.Checksum,
+		ms(r.MapInsert),
+		ms(r.BloomConstruct),
+		ms(r.BloomInsert),
+		strconv.FormatInt(r.MapAllocMB, 10),
+		strconv.FormatInt(r.BloomAllocMB, 10),
+		strconv.FormatInt(r.MapHeapMB, 10),
+		strconv.FormatInt(r.BloomHeapMB, 10),
+		strconv.FormatUint(r.MapMallocs, 10),
+		strconv.FormatInt(r.MapLive, 10),
+		strconv.FormatUint(r.BloomMallocs, 10),
+		strconv.FormatInt(r.BloomLive, 10),
+		strconv.FormatInt(r.MapRetained, 10),
+		strconv.Itoa(r.MapGobBytes),
+		float(r.MapBytesPerEntry()),
+		strconv.FormatInt(r.BloomRetained, 10),
+		strconv.Itoa(r.BloomBytes),
+		strconv.FormatUint(uint64(r.MapNumGC), 10),
+		strconv.FormatInt(r.MapGCPause.Microseconds(), 10),
+		strconv.FormatUint(uint64(r.BloomNumGC), 10),
+		strconv.FormatInt(r.BloomGCPause.Microseconds(), 10),
+		strconv.FormatInt(r.MapEncode.Microseconds(), 10),
+		strconv.FormatInt(r.MapSave.Microseconds(), 10),
+		strconv.FormatInt(r.BloomEncode.Microseconds(), 10),
+		strconv.FormatInt(r.BloomSave.Microseconds(), 10),
+		filtersJoin(r.Filters, func(f FilterResult) float64 { return f.MeasuredFP }),
+		filtersJoin(r.Filters, FilterResult.BytesPerEntry),
+		r.Status,
+		r.Build.Version,
+		r.Build.Go,
+		r.Build.Bloom,
+	}
+}
+
+// appends r to filename, writing the header first when the file is new
+func AppendCSV(filename string, r *Result) {
+	if err := AppendRows(filename, resultColumns, r.Row()); err != nil {
+		log.Fatalf("Error writing csv %s: %v", filename, err)
+	}
+}
+
+// the first record of filename, nil when it does not exist or is empty
+func csvHeader(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := csv.NewReader(f).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return header, err
+}
+
+// rows only go under the header they were written for, a column added
+// since would shift every value after it
+func CheckCSV(filename string, columns []string) error {
+	header, err := csvHeader(filename)
+	if err != nil {
+		return err
+	}
+	if header != nil && !slices.Equal(header, columns) {
+		return fmt.Errorf("%s has %d columns that differ from the %d this run writes, move it aside or pick another file", filename, len(header), len(columns))
+	}
+	return nil
+}
+
+// appends rows under columns, writing them first when the file is new
+func AppendRows(filename string, columns []string, rows ...[]string) (err error) {
+	if err := CheckCSV(filename, columns); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(columns)
+	}
+	return w.WriteAll(rows)
+}
+
+// the row, preceded by the header when asked for
+func (r *Result) WriteCSV(out io.Writer, header bool) error {
+	w := csv.NewWriter(out)
+	if header {
+		w.Write(resultColumns)
+	}
+	w.Write(r.Row())
+	w.Flush()
+	return w.Error()
+}
+
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// retained heap over distinct keys, what the map really costs per entry
+func (r *Result) MapBytesPerEntry() float64 {
+	return float64(r.MapRetained) / float64(max(r.Entries, 1))
+}
+
+// name=value pairs in filter order e.g "full=0.024 half=0.16"
+func filtersJoin(fils []FilterResult, value func(FilterResult) float64) string {
+	pairs := make([]string, len(fils))
+	for i, f := range fils {
+		pairs[i] = f.Name + "=" + strconv.FormatFloat(value(f), 'g', -1, 64)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// the run as an aligned table. filter rows share the bloom stage so only
+// carry what is known per filter
+func (r *Result) Table(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "mode\tentries\ttime_ms\talloc\theap\tmallocs\tretained\tbytes_per_entry\tmeasured_fp\tencode_us\tsave_us")
+	fmt.Fprintf(tw, "map\t%d\t%d\t%s\t%s\t%d\t%s\t%.2f\t-\t%d\t%d\n",
+		r.Entries, r.MapInsert.Milliseconds(), signedBytes(r.MapAlloc), signedBytes(r.MapHeap), r.MapMallocs,
+		signedBytes(r.MapRetained), r.MapBytesPerEntry(), r.MapEncode.Microseconds(), r.MapSave.Microseconds())
+	fmt.Fprintf(tw, "bloom\t%d\t%d\t%s\t%s\t%d\t%s\t-\t-\t%d\t%d\n",
+		r.Entries, (r.BloomConstruct + r.BloomInsert).Milliseconds(), signedBytes(r.BloomAlloc), signedBytes(r.BloomHeap), r.BloomMallocs,
+		signedBytes(r.BloomRetained), r.BloomEncode.Microseconds(), r.BloomSave.Microseconds())
+	for _, f := range r.Filters {
+		fmt.Fprintf(tw, "  %s\t%d\t-\t-\t-\t-\t%s\t%.2f\t%.4f\t%d\t%d\n", f.Name, f.Approx, humanBytes(uint64(f.Bytes)), f.BytesPerEntry(), f.MeasuredFP,
+			f.Encode.Microseconds(), f.Save.Microseconds())
+	}
+	tw.Flush()
+	if r.Half != nil {
+		r.Half.Table(w)
+	}
+	if r.Growth != nil {
+		r.Growth.Table(w)
+	}
+}
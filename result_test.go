@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	columns := []string{"a", "b"}
+	for _, row := range [][]string{{"1", "2"}, {"3", "4"}} {
+		if err := AppendRows(path, columns, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "a,b\n1,2\n3,4\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// a column added since the file was started
+	err = AppendRows(path, []string{"a", "b", "c"}, []string{"5", "6", "7"})
+	if err == nil || !strings.Contains(err.Error(), "move it aside") {
+		t.Fatalf("got %v, want the header mismatch refused", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Fatalf("refused rows were written: %q", after)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// heap in use once garbage is gone. the second collection empties the
+// sync.Pool victim caches the decoder leaves behind
+func settledHeap() int64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return int64(m.HeapAlloc)
+}
+
+// builds one structure alone, measures it, drops it and measures again. the
+// compare run keeps the map alive through the bloom stage, here nothing
+// else is live so the difference belongs to that structure only
+func measureRetained(ctx context.Context, mode string, build func(context.Context) any, extra ...any) {
+	base := settledHeap()
+	var held any
+	Stage(ctx, "retained-"+mode, func(ctx context.Context) {
+		held = build(ctx)
+	})
+	built := settledHeap()
+	runtime.KeepAlive(held)
+	held = nil
+	dropped := settledHeap()
+
+	args := []any{
+		"mode", mode,
+		"retained_bytes", built - base,
+		"released_bytes", built - dropped,
+		// what outlived the drop, should be near zero
+		"residual_bytes", dropped - base,
+	}
+	slog.Info("retained", append(args, extra...)...)
+}
+
+func RunRetained(ctx context.Context, cfg *Config) {
+	var distinct int
+	measureRetained(ctx, "map", func(ctx context.Context) any {
+		m := map[string]bool{}
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			if key, ok := cfg.keyFunc(md); ok {
+				m[key] = true
+			}
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+		distinct = len(m)
+		return m
+	})
+
+	m, k := bloom.EstimateParameters(cfg.N, cfg.FP)
+	measureRetained(ctx, "bloom", func(ctx context.Context) any {
+		fil := bloom.New(m, k)
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			if key, ok := cfg.keyFunc(md); ok {
+				fil.AddString(key)
+			}
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+		return fil
+	}, "bit_set_bytes", (m+63)/64*8)
+	slog.Info("retained entries", "distinct", distinct, "n", cfg.N, "fp", cfg.FP)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// push event ids decoded once so repeated iterations only measure the
+// structures, not the network or json
+func collectIds(ctx context.Context, cfg *Config) []string {
+	var ids []string
+	if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+		if key, ok := cfg.keyFunc(md); ok {
+			ids = append(ids, key)
+		}
+	})); err != nil {
+		log.Fatalf("Error reading input: %v", err)
+	}
+	return ids
+}
+
+type reuseStrategy struct {
+	mode string
+	// prepares the structure for the next iteration
+	reset func()
+	add   func(string)
+}
+
+// compares reallocating the map and filter each iteration against clearing
+// and reusing them. the default comparison run builds everything once, the
+// realloc strategies match it
+func RunReuse(ctx context.Context, cfg *Config) {
+	ids := collectIds(ctx, cfg)
+
+	var m map[string]bool
+	var fil *bloom.BloomFilter
+	strategies := []reuseStrategy{
+		{"map-realloc", func() { m = map[string]bool{} }, func(id string) { m[id] = true }},
+		{"map-clear", func() {
+			if m == nil {
+				m = map[string]bool{}
+			}
+			clear(m)
+		}, func(id string) { m[id] = true }},
+		{"bloom-realloc", func() { fil = bloom.NewWithEstimates(cfg.N, cfg.FP) }, func(id string) { fil.AddString(id) }},
+		{"bloom-clear", func() {
+			if fil == nil {
+				fil = bloom.NewWithEstimates(cfg.N, cfg.FP)
+			}
+			fil.ClearAll()
+		}, func(id string) { fil.AddString(id) }},
+	}
+
+	for _, s := range strategies {
+		m, fil = nil, nil
+		// the first iteration allocates for every strategy, leave it out
+		s.reset()
+		for _, id := range ids {
+			s.add(id)
+		}
+
+		var m1, m2 runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m1)
+		var stats RunStats
+		for stats.More(cfg) {
+			stats.Add(timeIt(func() {
+				s.reset()
+				for _, id := range ids {
+					s.add(id)
+				}
+			}))
+		}
+		runtime.ReadMemStats(&m2)
+
+		iters := uint64(max(stats.n, 1))
+		slog.Info(
+			"reuse",
+			"mode", s.mode,
+			"iterations", stats.n,
+			"count", len(ids),
+			"alloc_per_iter", humanBytes((m2.TotalAlloc-m1.TotalAlloc)/iters),
+			"mallocs_per_iter", (m2.Mallocs-m1.Mallocs)/iters,
+			"elapsed_us_per_iter", stats.Mean().Microseconds(),
+			"stddev_us", stats.Stddev().Microseconds(),
+			"cv", stats.CV(),
+			// false when -max-iterations ran out first
+			"converged", cfg.TargetCV == 0 || stats.CV() <= cfg.TargetCV,
+		)
+	}
+}
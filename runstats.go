@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// running mean and variance of repeated timings, welford's method so no
+// samples are kept
+type RunStats struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (s *RunStats) Add(d time.Duration) {
+	s.n += 1
+	x := float64(d)
+	delta := x - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (x - s.mean)
+}
+
+func (s *RunStats) Mean() time.Duration {
+	return time.Duration(s.mean)
+}
+
+// sample standard deviation, zero below two samples
+func (s *RunStats) Stddev() time.Duration {
+	if s.n < 2 {
+		return 0
+	}
+	return time.Duration(math.Sqrt(s.m2 / float64(s.n-1)))
+}
+
+// coefficient of variation, infinite until there are two samples to compare
+func (s *RunStats) CV() float64 {
+	if s.n < 2 || s.mean == 0 {
+		return math.Inf(1)
+	}
+	return float64(s.Stddev()) / s.mean
+}
+
+// at least -iterations, then with -target-cv more until the cv drops below
+// it or -max-iterations is reached
+func (s *RunStats) More(cfg *Config) bool {
+	if s.n < cfg.Iterations {
+		return true
+	}
+	return cfg.TargetCV > 0 && s.CV() > cfg.TargetCV && s.n < cfg.MaxIterations
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const S3_DEFAULT_REGION = "us-east-1"
+
+// query parameters of a pre-signed url that grant access, kept out of logs
+var signedParams = []string{"X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token", "Signature", "AWSAccessKeyId"}
+
+// the whole body of a multi-GB object cannot arrive within a client
+// timeout, only the response headers are bounded and -max-duration bounds
+// the rest
+var streamClient = &http.Client{Transport: streamTransport()}
+
+func streamTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = 15 * time.Second
+	return t
+}
+
+func isS3(input string) bool {
+	return strings.HasPrefix(input, "s3://")
+}
+
+// s3://bucket/key as an https url. without an endpoint the bucket is a
+// virtual host of the region in AWS_REGION, with one e.g a minio server
+// the bucket is the first path segment. requests are unsigned, a private
+// object needs a pre-signed https url as -input instead
+func s3URL(input, endpoint string) (string, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(input, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return "", fmt.Errorf("%q is not s3://bucket/key", input)
+	}
+	path := (&url.URL{Path: "/" + key}).EscapedPath()
+	if endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/" + bucket + path, nil
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = S3_DEFAULT_REGION
+	}
+	return "https://" + bucket + ".s3." + region + ".amazonaws.com" + path, nil
+}
+
+// rewrites an s3:// -input to the url it is fetched from
+func resolveS3(cfg *Config) {
+	if !isS3(cfg.Input) {
+		return
+	}
+	u, err := s3URL(cfg.Input, cfg.S3Endpoint)
+	if err != nil {
+		log.Fatalf("Invalid -input: %v", err)
+	}
+	slog.Debug("s3 input", "input", cfg.Input, "url", u)
+	cfg.Input = u
+}
+
+// u without a password or the signature of a pre-signed url
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	redacted := false
+	for _, p := range signedParams {
+		if q.Has(p) {
+			q.Set(p, "xxxxx")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.Redacted()
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.Redacted()
+}
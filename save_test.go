@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveGzip(t *testing.T) {
+	data := bytes.Repeat([]byte("bloom vs map "), 1000)
+	file := filepath.Join(t.TempDir(), "data.gob")
+	if err := Save(file, data); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		t.Fatalf("file starts with % x, want the gzip magic 1f 8b", raw[:min(len(raw), 2)])
+	}
+	fz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(fz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("decompressed %d bytes, want the %d saved", len(got), len(data))
+	}
+	if loaded, err := Load(file); err != nil || !bytes.Equal(loaded, data) {
+		t.Fatalf("Load gave %d bytes, err %v, want the %d saved", len(loaded), err, len(data))
+	}
+}
+
+// the map artifact is a gob of the map, it has to survive Save and Load
+func TestSaveGobRoundTrip(t *testing.T) {
+	m := map[string]bool{"a": true, "b": true, "c": true}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "mapBytes.gob")
+	if err := Save(file, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := map[string]bool{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(loaded, m) {
+		t.Fatalf("got %v, want %v", loaded, m)
+	}
+}
+
+func TestSaveError(t *testing.T) {
+	if err := Save(filepath.Join(t.TempDir(), "missing", "data.gob"), []byte("x")); err == nil {
+		t.Fatal("saved into a directory that does not exist")
+	}
+}
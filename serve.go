@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serves mux on addr until ctx is done or the process gets a signal, then
+// shuts down gracefully
+func listenUntilSignal(ctx context.Context, addr string, mux http.Handler) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	slog.Info("listening", "addr", addr)
+
+	select {
+	case err := <-errs:
+		log.Fatalf("Error serving on %s: %v", addr, err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Warn("shutdown", "err", err)
+	}
+	slog.Info("stopped serving", "addr", addr)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("writing response", "err", err)
+	}
+}
+
+// keeps the compare run's filters queryable over http. /test asks the
+// first filter unless filter= names another, /stats lists all of them
+func Serve(ctx context.Context, cfg *Config, fils []*Filter) {
+	byName := map[string]*Filter{}
+	for _, f := range fils {
+		byName[f.name] = f
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /test", func(w http.ResponseWriter, r *http.Request) {
+		id := cfg.normalizeKey(r.URL.Query().Get("id"))
+		if id == "" {
+			http.Error(w, "missing id", http.StatusBadRequest)
+			return
+		}
+		f := fils[0]
+		if name := r.URL.Query().Get("filter"); name != "" {
+			if f = byName[name]; f == nil {
+				http.Error(w, "no filter "+name, http.StatusNotFound)
+				return
+			}
+		}
+		writeJSON(w, map[string]any{"filter": f.name, "present": f.TestString(id)})
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		stats := make([]map[string]any, len(fils))
+		for i, f := range fils {
+			stats[i] = map[string]any{
+				"filter":       f.name,
+				"n":            f.n,
+				"m":            f.fil.Cap(),
+				"k":            f.fil.K(),
+				"bloom_approx": f.fil.ApproximatedSize(),
+				"bloom_bytes":  f.fil.BitSet().BinaryStorageSize(),
+			}
+		}
+		writeJSON(w, map[string]any{"key": cfg.Key, "filters": stats})
+	})
+	listenUntilSignal(ctx, cfg.Serve, mux)
+}
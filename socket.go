@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// accepts one connection on a unix socket and decodes what the producer
+// writes, gzipped or not, until it closes its end. a socket cannot be read
+// twice so the map and the filters fill in the same pass
+func RunSocket(ctx context.Context, cfg *Config) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// a socket file left behind by a killed run would fail the listen
+	if fi, err := os.Lstat(cfg.ListenSocket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(cfg.ListenSocket)
+	}
+	ln, err := net.Listen("unix", cfg.ListenSocket)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", cfg.ListenSocket, err)
+	}
+	// closing the listener also removes the socket file
+	defer ln.Close()
+	context.AfterFunc(ctx, func() { ln.Close() })
+	slog.Info("listening", "socket", cfg.ListenSocket)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			slog.Info("stopped listening", "socket", cfg.ListenSocket)
+			return
+		}
+		log.Fatalf("Error accepting on %s: %v", cfg.ListenSocket, err)
+	}
+	ln.Close()
+	defer conn.Close()
+	context.AfterFunc(ctx, func() { conn.Close() })
+	body, err := maybeGunzip(conn)
+	if err != nil {
+		log.Fatalf("Error reading input from %s: %v", cfg.ListenSocket, err)
+	}
+
+	fils, err := newFilters(cfg)
+	if err != nil {
+		log.Fatalf("bad -filters %q: %v", cfg.Filters, err)
+	}
+	mp := NewMapProcessor(cfg.keyFunc, 0)
+	start := time.Now()
+	status := "completed"
+	count, err := decodeInput(ctx, cfg, body, drive([]Processor{mp, NewFiltersProcessor(cfg.keyFunc, fils, false)}))
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		status = "interrupted"
+		cfg.state.timedOut = true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		if err := keepTruncated(cfg, count, err); err != nil {
+			log.Fatalf("Error decoding socket input: %v", err)
+		}
+		status = "truncated"
+	default:
+		log.Fatalf("Error decoding socket input: %v", err)
+	}
+	slog.Info("entries", "mode", "socket", "count", count, "distinct", len(mp.set), "status", status, "elapsed_ms", time.Since(start).Milliseconds())
+
+	if _, err := Confirm(cfg, mp.set, fils); err != nil {
+		log.Fatalf("confirm failed: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"runtime"
+	"slices"
+	"sort"
+	"time"
+)
+
+// exact membership without the map's per entry overhead, lookups are
+// O(log n) binary searches
+type SortedSet []string
+
+func (s SortedSet) Contains(id string) bool {
+	i := sort.SearchStrings(s, id)
+	return i < len(s) && s[i] == id
+}
+
+func RunSortedStage(ctx context.Context, cfg *Config) SortedSet {
+	var m1, m2 runtime.MemStats
+	var ids []string
+
+	runtime.GC()
+	runtime.ReadMemStats(&m1)
+	var collect time.Duration
+	Stage(ctx, "streaming-sorted", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(timeProc(func(md *Model) {
+			if key, ok := cfg.keyFunc(md); ok {
+				ids = append(ids, key)
+			}
+		}, &collect))); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+	build := timeIt(func() {
+		sort.Strings(ids)
+		ids = slices.Compact(ids)
+		ids = slices.Clip(ids)
+	})
+	runtime.GC()
+	runtime.ReadMemStats(&m2)
+
+	slog.Info(
+		"sorted slice",
+		"count", len(ids),
+		"collect_ms", collect.Milliseconds(),
+		"sort_ms", build.Milliseconds(),
+		"retained", humanDelta(m1.HeapAlloc, m2.HeapAlloc),
+	)
+	return SortedSet(ids)
+}
+
+// half present ids and half known negatives, looked up in every structure
+func compareLookups(sorted SortedSet, set map[string]bool, fil *Filter) {
+	queries := append(keysOf(set), NegativeIds(set, len(set))...)
+
+	lookups := []struct {
+		mode     string
+		contains func(string) bool
+	}{
+		{"map", func(id string) bool { return set[id] }},
+		{"bloom", fil.TestString},
+		{"sorted", sorted.Contains},
+	}
+	for _, l := range lookups {
+		found := 0
+		elapsed := timeIt(func() {
+			for _, q := range queries {
+				if l.contains(q) {
+					found += 1
+				}
+			}
+		})
+		slog.Info(
+			"lookups",
+			"mode", l.mode,
+			"queries", len(queries),
+			"found", found,
+			"elapsed_ms", elapsed.Milliseconds(),
+			"ns_op", elapsed.Nanoseconds()/int64(max(len(queries), 1)),
+		)
+	}
+}
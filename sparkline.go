@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+)
+
+const (
+	// heap marked live by the last collection
+	HEAP_LIVE_METRIC = "/gc/heap/live:bytes"
+	SPARKLINE_WIDTH  = 60
+)
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// heap growth over a pass, read every -sparkline entries
+type HeapSampler struct {
+	every   int
+	count   int
+	base    int64
+	sample  []metrics.Sample
+	Samples []int64
+}
+
+// the heap at creation is the baseline, create it right before the pass
+func NewHeapSampler(every int) *HeapSampler {
+	h := &HeapSampler{every: every, sample: []metrics.Sample{{Name: HEAP_LIVE_METRIC}}}
+	h.base = h.read()
+	return h
+}
+
+// collects first, decoding garbage and the few collections of a small pass
+// otherwise hide what the structure retains
+func (h *HeapSampler) read() int64 {
+	runtime.GC()
+	metrics.Read(h.sample)
+	return int64(h.sample[0].Value.Uint64())
+}
+
+func (h *HeapSampler) Wrap(proc func(*Model)) func(*Model) {
+	return func(md *Model) {
+		proc(md)
+		h.count += 1
+		if h.count%h.every == 0 {
+			h.Samples = append(h.Samples, max(h.read()-h.base, 0))
+		}
+	}
+}
+
+// the map and bloom passes, drawn against one scale so the bloom's flat
+// line reads against the map's slope
+type HeapGrowth struct {
+	Every int
+	Map   []int64
+	Bloom []int64
+}
+
+// at most width bars, each the largest of the samples it covers
+func sparkline(samples []int64, width int, top int64) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	bars := min(len(samples), width)
+	var b strings.Builder
+	for i := range bars {
+		lo, hi := i*len(samples)/bars, (i+1)*len(samples)/bars
+		peak := samples[lo]
+		for _, v := range samples[lo:hi] {
+			peak = max(peak, v)
+		}
+		level := 0
+		if top > 0 {
+			level = int(peak * int64(len(sparkBars)-1) / top)
+		}
+		b.WriteRune(sparkBars[level])
+	}
+	return b.String()
+}
+
+func (g *HeapGrowth) Table(w io.Writer) {
+	var top int64
+	for _, v := range append(append([]int64(nil), g.Map...), g.Bloom...) {
+		top = max(top, v)
+	}
+	entries := g.Every * max(len(g.Map), len(g.Bloom))
+	fmt.Fprintf(w, "\nheap growth over %d entries, one sample every %d, 0 to %s\n", entries, g.Every, humanBytes(uint64(top)))
+	fmt.Fprintf(w, "  map    %s\n", sparkline(g.Map, SPARKLINE_WIDTH, top))
+	fmt.Fprintf(w, "  bloom  %s\n", sparkline(g.Bloom, SPARKLINE_WIDTH, top))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// a subcommand exposes part of the flat flag set, parsing its arguments
+// into the same variables so everything after parsing is unchanged
+type Subcommand struct {
+	Name  string
+	Usage string
+	Flags []string
+	// defaults of its own, an explicit flag or its variable still wins
+	Defaults map[string]string
+}
+
+var (
+	logFlags   = []string{"log-level", "log-json", "quiet", "e", "cpuprofile", "mem-limit"}
+	inputFlags = []string{
+		"input", "format", "array-key", "line-buffer", "json-impl", "in-memory", "max-inmemory-bytes",
+		"allow-partial", "max-duration", "auth-bearer", "auth-basic", "cache", "refresh-cache", "retries",
+		"s3-endpoint", "gharchive", "listen-socket", "key", "jsonpath", "normalize",
+	}
+	sizeFlags = []string{"n", "fp", "filters", "half-ratio", "bloom-m", "bloom-k", "hash-seed"}
+)
+
+func flagList(groups ...[]string) []string {
+	var names []string
+	for _, g := range groups {
+		names = append(names, g...)
+	}
+	return names
+}
+
+var subcommands = []Subcommand{
+	{
+		Name:  "ingest",
+		Usage: "Build the map and the filters from the input and save them, without a report",
+		Flags: flagList(logFlags, inputFlags, sizeFlags, []string{
+			"outdir", "gzip-level", "dump-ids", "export-json", "transform-out", "checkpoint-interval", "resume",
+		}),
+		Defaults: map[string]string{"output": OUTPUT_NONE},
+	},
+	{
+		Name:  "query",
+		Usage: "Build from the input then time lookups, query a bucket or serve the first filter over http",
+		Flags: flagList(logFlags, inputFlags, sizeFlags, []string{
+			"outdir", "query-count", "query-hit-ratio", "sorted", "serve", "bucket", "bucket-cap", "query-bucket", "query-id",
+		}),
+		Defaults: map[string]string{"output": OUTPUT_NONE},
+	},
+	{
+		Name:  "compare",
+		Usage: "Build the map and the filters and report what each cost, the default of the flat flags",
+		Flags: flagList(logFlags, inputFlags, sizeFlags, []string{
+			"output", "csv", "outdir", "manifest", "negatives", "confirm-workers", "gzip-level", "approx-every", "bloom-pretest",
+			"sparkline", "compact", "presize", "decode-latency", "checkpoint-interval", "resume", "metrics-file",
+			"baseline", "update-baseline", "baseline-threshold", "adversarial",
+		}),
+	},
+	{
+		Name:     "merge",
+		Usage:    "Fill a locked bloom and per worker blooms merged at the end, or union the filters of -novelty steps",
+		Flags:    flagList(logFlags, inputFlags, []string{"workers", "buffer", "negatives", "novelty", "order-check"}),
+		Defaults: map[string]string{"workers": strconv.Itoa(runtime.NumCPU())},
+	},
+	{
+		Name:  "verify",
+		Usage: "Reload and confirm the saved artifacts or diff two saved filters, without reading the input",
+		Flags: flagList(logFlags, sizeFlags, []string{
+			"outdir", "negatives", "confirm-workers", "diff-filters",
+		}),
+		Defaults: map[string]string{"verify-artifacts": "true", "output": OUTPUT_NONE},
+	},
+}
+
+func findSubcommand(name string) *Subcommand {
+	for i := range subcommands {
+		if subcommands[i].Name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// parses args with only the subcommand's flags. they share the flat set's
+// values and are set again through it so flag.Visit, and with it -env and
+// the explicit checks in main, sees them as set. the defaults go into the
+// values only, left unset they still give way to BVM_* variables
+func (s *Subcommand) parse(args []string) error {
+	for name, v := range s.Defaults {
+		f := flag.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("default for no flag -%s", name)
+		}
+		if err := f.Value.Set(v); err != nil {
+			return fmt.Errorf("default -%s=%s: %w", name, v, err)
+		}
+		f.DefValue = v
+	}
+	fs := flag.NewFlagSet(s.Name, flag.ExitOnError)
+	for _, name := range s.Flags {
+		f := flag.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("no flag -%s", name)
+		}
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage of %s %s:\n  %s\n\n", os.Args[0], s.Name, s.Usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if e := flag.Set(f.Name, f.Value.String()); e != nil && err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+// the first argument picks a subcommand. flags without one keep the flat
+// set with every flag, nothing at all prints the subcommands unless the
+// environment sets some flag, then it is a flat run too
+func parseArgs(args []string) error {
+	if len(args) == 0 && !envSet() {
+		subcommandUsage()
+		os.Exit(2)
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return flag.CommandLine.Parse(args)
+	}
+	first := args[0]
+	sub := findSubcommand(first)
+	if sub == nil {
+		subcommandUsage()
+		return fmt.Errorf("unknown subcommand %q", first)
+	}
+	if err := sub.parse(args[1:]); err != nil {
+		return fmt.Errorf("%s: %w", sub.Name, err)
+	}
+	return flag.CommandLine.Parse(nil)
+}
+
+func subcommandUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s <subcommand> [flags]\n\nSubcommands:\n", os.Args[0])
+	for _, s := range subcommands {
+		fmt.Fprintf(out, "  %-8s %s\n", s.Name, s.Usage)
+	}
+	fmt.Fprintf(out, "\nRun %s <subcommand> -h for its flags. Flags without a subcommand, see %s -h,\n", os.Args[0], os.Args[0])
+	fmt.Fprintf(out, "take every option of every mode and run compare by default\n")
+}
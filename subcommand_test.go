@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+// an explicit flag wins over its variable, the variable over the
+// subcommand's default, the default over the flat set's
+func TestSubcommandDefaults(t *testing.T) {
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{"default", nil, "", OUTPUT_NONE},
+		{"env over default", nil, OUTPUT_JSON, OUTPUT_JSON},
+		{"flag over env", []string{"-output", OUTPUT_CSV}, OUTPUT_JSON, OUTPUT_CSV},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flag.CommandLine = flag.NewFlagSet("bvm", flag.ContinueOnError)
+			output := flag.String("output", OUTPUT_TABLE, "")
+			if tc.env != "" {
+				t.Setenv(envName("output"), tc.env)
+			}
+			sub := Subcommand{Name: "test", Flags: []string{"output"}, Defaults: map[string]string{"output": OUTPUT_NONE}}
+			if err := sub.parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyEnv(); err != nil {
+				t.Fatal(err)
+			}
+			if *output != tc.want {
+				t.Fatalf("-output is %q, want %q", *output, tc.want)
+			}
+		})
+	}
+}
+
+// with no arguments the variables alone make a flat run
+func TestNoArgsEnvRun(t *testing.T) {
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("bvm", flag.ContinueOnError)
+	output := flag.String("output", OUTPUT_TABLE, "")
+	t.Setenv(envName("output"), OUTPUT_JSON)
+
+	if err := parseArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !flag.Parsed() {
+		t.Fatal("no arguments left the flat set unparsed")
+	}
+	if err := applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if *output != OUTPUT_JSON {
+		t.Fatalf("-output is %q, want %q", *output, OUTPUT_JSON)
+	}
+}
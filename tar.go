@@ -0,0 +1,79 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// the gzip layer is already gone by the time decodeInput sees the archive
+func isTarName(input string) bool {
+	if u, err := url.Parse(input); err == nil && isURL(input) {
+		input = u.Path
+	}
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(input, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// the decoder for a member, by extension. members may be gzipped themselves
+func memberFormat(name string) string {
+	name = strings.TrimSuffix(name, ".gz")
+	switch {
+	case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"):
+		return FORMAT_NDJSON
+	case strings.HasSuffix(name, ".json"):
+		return FORMAT_ARRAY
+	}
+	return ""
+}
+
+// decodes every json and ndjson member of a tar stream in archive order
+func decodeTar(ctx context.Context, cfg *Config, r io.Reader, proc func(*Model)) (count int, err error) {
+	tr := tar.NewReader(r)
+	members := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		format := memberFormat(hdr.Name)
+		if format == "" {
+			slog.Info("skipping archive member, not json", "member", hdr.Name)
+			continue
+		}
+
+		body, err := maybeGunzip(io.NopCloser(tr))
+		if err != nil {
+			return count, fmt.Errorf("member %s: %w", hdr.Name, err)
+		}
+		var n int
+		if format == FORMAT_NDJSON {
+			n, err = decodeLines(ctx, body, cfg.LineBuffer, proc)
+		} else {
+			n, err = decodeStream(ctx, body, cfg.ArrayKey, proc)
+		}
+		body.Close()
+		count += n
+		if err != nil {
+			return count, fmt.Errorf("member %s: %w", hdr.Name, err)
+		}
+		members += 1
+		slog.Info("archive member", "member", hdr.Name, "format", format, "count", n)
+	}
+	slog.Debug("archive", "members", members, "count", count)
+	return count, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// writes every included event back out as a json line, e.g a push events
+// only copy of the input. only the fields Model decodes survive
+type TransformWriter struct {
+	key   KeyFunc
+	f     *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	count int
+	err   error
+}
+
+func NewTransformWriter(filename string, key KeyFunc) (*TransformWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &TransformWriter{key: key, f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// wraps proc, writing the events the key includes. the first write error
+// stops the writing and is returned by Close, proc still sees every event
+func (t *TransformWriter) Wrap(proc func(*Model)) func(*Model) {
+	return func(md *Model) {
+		if _, ok := t.key(md); ok && t.err == nil {
+			// Encode ends every value with a newline
+			t.err = t.enc.Encode(md)
+			t.count += 1
+		}
+		proc(md)
+	}
+}
+
+func (t *TransformWriter) Close() error {
+	err := t.err
+	if ferr := t.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
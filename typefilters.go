@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// what one event type's ids cost in each structure
+type TypeMemory struct {
+	Type     string `json:"type"`
+	Entries  int    `json:"entries"`
+	Distinct int    `json:"distinct"`
+	KeyBytes int    `json:"key_bytes"`
+	// its keys plus its share of the measured per entry overhead
+	MapBytes   int64 `json:"map_bytes"`
+	BloomBytes int   `json:"bloom_bytes"`
+}
+
+// one map and one bloom of -key per event type, every type and not only
+// pushes. the maps are measured together, each type is charged its own key
+// bytes and the average overhead of an entry on top. the blooms are sized
+// for the distinct keys the maps found at -fp
+func RunTypeFilters(ctx context.Context, cfg *Config) {
+	key := typeKeyFunc(cfg)
+	typeMaps := map[string]map[string]bool{}
+	entries := map[string]int{}
+
+	base := settledHeap()
+	Stage(ctx, "type-maps", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			k, ok := key(md)
+			if !ok {
+				return
+			}
+			ids, ok := typeMaps[md.Type]
+			if !ok {
+				ids = map[string]bool{}
+				typeMaps[md.Type] = ids
+			}
+			ids[k] = true
+			entries[md.Type] += 1
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+	retained := settledHeap() - base
+
+	typeBlooms := map[string]*bloom.BloomFilter{}
+	for t, ids := range typeMaps {
+		typeBlooms[t] = bloom.NewWithEstimates(uint(len(ids)), cfg.FP)
+	}
+	Stage(ctx, "type-blooms", func(ctx context.Context) {
+		if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+			k, ok := key(md)
+			if !ok {
+				return
+			}
+			fil, ok := typeBlooms[md.Type]
+			if !ok {
+				// a type the map pass never reached, e.g it stopped at
+				// -max-duration, has no count to size for
+				fil = bloom.NewWithEstimates(cfg.N, cfg.FP)
+				typeBlooms[md.Type] = fil
+				typeMaps[md.Type] = map[string]bool{}
+			}
+			fil.AddString(k)
+		})); err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+	})
+
+	report := typeMemory(typeMaps, entries, typeBlooms, retained)
+	var mapTotal int64
+	bloomTotal := 0
+	for _, r := range report {
+		mapTotal += r.MapBytes
+		bloomTotal += r.BloomBytes
+	}
+	for _, r := range report {
+		slog.Info(
+			"type memory",
+			"type", r.Type,
+			"entries", r.Entries,
+			"distinct", r.Distinct,
+			"key_bytes", r.KeyBytes,
+			"map_bytes", r.MapBytes,
+			"map_pct", 100*float64(r.MapBytes)/float64(max(mapTotal, 1)),
+			"bloom_bytes", r.BloomBytes,
+			"bloom_pct", 100*float64(r.BloomBytes)/float64(max(bloomTotal, 1)),
+		)
+	}
+	slog.Info("type memory total", "types", len(report), "map_bytes", mapTotal, "bloom_bytes", bloomTotal, "fp", cfg.FP)
+	if cfg.Output == OUTPUT_JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("Error writing the result: %v", err)
+		}
+	}
+}
+
+// sorted by the memory of both structures, largest first. a type the bloom
+// pass never reached has no bloom bytes
+func typeMemory(typeMaps map[string]map[string]bool, entries map[string]int, typeBlooms map[string]*bloom.BloomFilter, retained int64) []TypeMemory {
+	report := make([]TypeMemory, 0, len(typeMaps))
+	distinct, keyBytes := 0, 0
+	for t, ids := range typeMaps {
+		r := TypeMemory{Type: t, Entries: entries[t], Distinct: len(ids)}
+		if fil := typeBlooms[t]; fil != nil {
+			r.BloomBytes = fil.BitSet().BinaryStorageSize()
+		}
+		for id := range ids {
+			r.KeyBytes += len(id)
+		}
+		distinct += r.Distinct
+		keyBytes += r.KeyBytes
+		report = append(report, r)
+	}
+	// buckets, headers and the maps themselves averaged over every entry
+	overhead := float64(retained-int64(keyBytes)) / float64(max(distinct, 1))
+	for i := range report {
+		r := &report[i]
+		r.MapBytes = int64(r.KeyBytes) + int64(overhead*float64(r.Distinct))
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].MapBytes+int64(report[i].BloomBytes) > report[j].MapBytes+int64(report[j].BloomBytes)
+	})
+	return report
+}
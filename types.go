@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// a handful of distinct event types, sized generously
+const TYPES_N = 64
+
+// lists the distinct event types in the input, the exact set comes from the
+// map while the tiny bloom shows how close its estimate gets
+func RunTypes(ctx context.Context, cfg *Config) {
+	typeCounts := map[string]int{}
+	typeFil := bloom.NewWithEstimates(TYPES_N, 0.01)
+
+	if err := ReadAllStreaming(ctx, cfg, ProcessFunc(func(md *Model) {
+		typeCounts[md.Type] += 1
+		typeFil.AddString(md.Type)
+	})); err != nil {
+		log.Fatalf("Error reading input: %v", err)
+	}
+
+	types := make([]string, 0, len(typeCounts))
+	for t := range typeCounts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return typeCounts[types[i]] > typeCounts[types[j]]
+	})
+
+	for _, t := range types {
+		if t == "" {
+			// nothing decoded into Type, likely a schema mismatch
+			slog.Warn("event type missing", "count", typeCounts[t])
+			continue
+		}
+		slog.Info("event type", "type", t, "count", typeCounts[t], "bloom", typeFil.TestString(t))
+	}
+	slog.Info("event types", "count", len(types), "bloom_approx", typeFil.ApproximatedSize())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// -fp left at 0 is BLOOM_FP, or with a pinned filter what -bloom-m and
+// -bloom-k give at -n, which reports and artifact headers compare against
+func (c *Config) resolveFP() {
+	if c.FP != 0 {
+		return
+	}
+	c.FP = BLOOM_FP
+	if c.BloomM > 0 && c.BloomK > 0 {
+		c.FP = fpFor(c.BloomM, c.BloomK, int(c.N))
+	}
+}
+
+// checks the flags, or a manifest entry, before any work starts. every
+// problem is reported at once rather than the first one per run
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.N > 0, "-n must be positive")
+	if c.BloomM == 0 {
+		check(c.FP > 0 && c.FP < 1, "-fp must be within (0, 1), got %v", c.FP)
+	}
+	check((c.BloomM == 0) == (c.BloomK == 0), "-bloom-m and -bloom-k must be set together")
+	// m and k fix the false positive rate for any n, -n still sizes the
+	// reports and the half filter
+	if c.BloomM > 0 && c.BloomK > 0 {
+		pinned := fpFor(c.BloomM, c.BloomK, int(c.N))
+		check(c.FP == pinned, "-fp %v contradicts -bloom-m and -bloom-k, which give %v at -n %d", c.FP, pinned, c.N)
+	}
+	check(c.HalfRatio > 0, "-half-ratio must be positive, got %v", c.HalfRatio)
+	check(c.QueryHitRatio >= 0 && c.QueryHitRatio <= 1, "-query-hit-ratio must be within [0, 1], got %v", c.QueryHitRatio)
+	check(c.Format == "" || c.Format == FORMAT_ARRAY || c.Format == FORMAT_NDJSON || c.Format == FORMAT_TAR,
+		"-format must be %s, %s or %s, got %q", FORMAT_ARRAY, FORMAT_NDJSON, FORMAT_TAR, c.Format)
+	check(c.BucketBy == "" || c.BucketBy == BUCKET_HOUR || c.BucketBy == BUCKET_DAY,
+		"-bucket must be %s or %s, got %q", BUCKET_HOUR, BUCKET_DAY, c.BucketBy)
+	check(c.Output == OUTPUT_TABLE || c.Output == OUTPUT_JSON || c.Output == OUTPUT_CSV || c.Output == OUTPUT_NONE,
+		"-output must be %s, %s, %s or %s, got %q", OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_CSV, OUTPUT_NONE, c.Output)
+	check(c.BucketCap > 0, "-bucket-cap must be positive")
+	check(c.QueryBucket == "" || c.BucketBy != "", "-query-bucket needs -bucket")
+	check(c.LineBuffer > 0, "-line-buffer must be positive, got %d", c.LineBuffer)
+	check(c.Iterations > 0, "-iterations must be positive, got %d", c.Iterations)
+	check(c.GzipLevel == gzip.DefaultCompression || (c.GzipLevel >= gzip.BestSpeed && c.GzipLevel <= gzip.BestCompression),
+		"-gzip-level must be %d to %d or %d, got %d", gzip.BestSpeed, gzip.BestCompression, gzip.DefaultCompression, c.GzipLevel)
+	check(!c.UpdateBaseline || c.Baseline != "", "-update-baseline needs -baseline")
+	check(c.BaselinePct >= 0, "-baseline-threshold must not be negative, got %v", c.BaselinePct)
+	check(c.TargetCV >= 0, "-target-cv must not be negative, got %v", c.TargetCV)
+	check(c.TargetCV == 0 || c.MaxIterations >= c.Iterations, "-max-iterations %d is below -iterations %d", c.MaxIterations, c.Iterations)
+	check(c.DiffFilters == "" || len(strings.Split(c.DiffFilters, ",")) == 2, "-diff-filters wants two files a.gob,b.gob, got %q", c.DiffFilters)
+	if c.OrderCheck != "" {
+		_, err := parseWorkerCounts(c.OrderCheck)
+		check(err == nil, "bad -order-check: %v", err)
+	}
+	check(c.ConfirmWorkers >= 0, "-confirm-workers must not be negative, got %d", c.ConfirmWorkers)
+	// a slice rather than a map keeps the errors in flag order
+	for _, f := range []struct {
+		name string
+		v    int
+	}{
+		{"-workers", c.Workers},
+		{"-buffer", c.Buffer},
+		{"-negatives", c.Negatives},
+		{"-retries", c.Retries},
+		{"-lru", c.LRU},
+		{"-query-count", c.QueryCount},
+		{"-approx-every", c.ApproxEvery},
+	} {
+		check(f.v >= 0, "%s must not be negative, got %d", f.name, f.v)
+	}
+	check(c.MemLimit >= 0, "-mem-limit must not be negative, got %d", c.MemLimit)
+	check(c.MaxInMemory >= 0, "-max-inmemory-bytes must not be negative, got %d", c.MaxInMemory)
+	check(c.Checkpoint >= 0, "-checkpoint-interval must not be negative, got %v", c.Checkpoint)
+	check(c.MaxDuration >= 0, "-max-duration must not be negative, got %v", c.MaxDuration)
+	check(c.FPCost >= 0, "-fp-cost must not be negative, got %v", c.FPCost)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// what the flag defaults amount to
+func validConfig() *Config {
+	cfg := testConfig("events.json")
+	cfg.N = 12000
+	cfg.FP = 0.1
+	cfg.HalfRatio = 0.5
+	cfg.QueryHitRatio = 0.5
+	cfg.Output = OUTPUT_TABLE
+	cfg.BucketCap = 1000
+	cfg.Iterations = 1
+	cfg.GzipLevel = gzip.DefaultCompression
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("defaults rejected: %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"zero n", func(c *Config) { c.N = 0 }, "-n must be positive"},
+		{"fp of 0", func(c *Config) { c.FP = 0 }, "-fp must be within (0, 1)"},
+		{"fp of 1", func(c *Config) { c.FP = 1 }, "-fp must be within (0, 1)"},
+		{"m without k", func(c *Config) { c.BloomM = 1 << 16 }, "-bloom-m and -bloom-k must be set together"},
+		{"k without m", func(c *Config) { c.BloomK = 4 }, "-bloom-m and -bloom-k must be set together"},
+		{"fp with m and k", func(c *Config) { c.BloomM, c.BloomK = 1<<16, 4 }, "-fp 0.1 contradicts -bloom-m and -bloom-k"},
+		{"half ratio", func(c *Config) { c.HalfRatio = 0 }, "-half-ratio must be positive"},
+		{"hit ratio", func(c *Config) { c.QueryHitRatio = 1.5 }, "-query-hit-ratio must be within [0, 1]"},
+		{"format", func(c *Config) { c.Format = "xml" }, "-format must be"},
+		{"bucket", func(c *Config) { c.BucketBy = "week" }, "-bucket must be"},
+		{"output", func(c *Config) { c.Output = "yaml" }, "-output must be"},
+		{"bucket cap", func(c *Config) { c.BucketCap = 0 }, "-bucket-cap must be positive"},
+		{"query bucket", func(c *Config) { c.QueryBucket = "2024-01-01" }, "-query-bucket needs -bucket"},
+		{"line buffer", func(c *Config) { c.LineBuffer = 0 }, "-line-buffer must be positive"},
+		{"iterations", func(c *Config) { c.Iterations = 0 }, "-iterations must be positive"},
+		{"gzip level", func(c *Config) { c.GzipLevel = 10 }, "-gzip-level must be"},
+		{"update baseline", func(c *Config) { c.UpdateBaseline = true }, "-update-baseline needs -baseline"},
+		{"baseline threshold", func(c *Config) { c.BaselinePct = -1 }, "-baseline-threshold must not be negative"},
+		{"target cv", func(c *Config) { c.TargetCV = -1 }, "-target-cv must not be negative"},
+		{"max iterations", func(c *Config) { c.TargetCV, c.Iterations, c.MaxIterations = 0.05, 5, 3 }, "-max-iterations 3 is below -iterations 5"},
+		{"diff filters", func(c *Config) { c.DiffFilters = "a.gob" }, "-diff-filters wants two files"},
+		{"order check", func(c *Config) { c.OrderCheck = "x" }, "bad -order-check"},
+		{"confirm workers", func(c *Config) { c.ConfirmWorkers = -1 }, "-confirm-workers must not be negative"},
+		{"workers", func(c *Config) { c.Workers = -1 }, "-workers must not be negative"},
+		{"negatives", func(c *Config) { c.Negatives = -1 }, "-negatives must not be negative"},
+		{"mem limit", func(c *Config) { c.MemLimit = -1 }, "-mem-limit must not be negative"},
+		{"max in memory", func(c *Config) { c.MaxInMemory = -1 }, "-max-inmemory-bytes must not be negative"},
+		{"checkpoint", func(c *Config) { c.Checkpoint = -time.Second }, "-checkpoint-interval must not be negative"},
+		{"max duration", func(c *Config) { c.MaxDuration = -time.Second }, "-max-duration must not be negative"},
+		{"fp cost", func(c *Config) { c.FPCost = -1 }, "-fp-cost must not be negative"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// every problem is reported, in the same order each time
+func TestValidateOrder(t *testing.T) {
+	cfg := validConfig()
+	cfg.N, cfg.Workers, cfg.Buffer, cfg.Negatives, cfg.Retries = 0, -1, -1, -1, -1
+	want := "-n must be positive\n" +
+		"-workers must not be negative, got -1\n" +
+		"-buffer must not be negative, got -1\n" +
+		"-negatives must not be negative, got -1\n" +
+		"-retries must not be negative, got -1"
+	for range 20 {
+		if err := cfg.Validate(); err == nil || err.Error() != want {
+			t.Fatalf("got %q, want %q", err, want)
+		}
+	}
+}
+
+// -m and -k fix the fp whichever way the config was put together, flags,
+// variables or a manifest entry, and only a differing fp contradicts them
+func TestPinnedFP(t *testing.T) {
+	cfg := validConfig()
+	cfg.FP = 0
+	cfg.resolveFP()
+	if cfg.FP != BLOOM_FP {
+		t.Fatalf("unset fp resolved to %v, want %v", cfg.FP, BLOOM_FP)
+	}
+
+	base := validConfig()
+	base.FP, base.BloomM, base.BloomK = 0, 1<<16, 4
+	base.resolveFP()
+	if err := base.Validate(); err != nil {
+		t.Fatalf("pinned filter rejected: %v", err)
+	}
+	if want := fpFor(1<<16, 4, int(base.N)); base.FP != want {
+		t.Fatalf("pinned fp %v, want %v", base.FP, want)
+	}
+
+	cfgs, err := LoadManifest(writeInput(t, "manifest.json", []byte(`[{"N": 5000}, {"BloomK": 6}]`)), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range cfgs {
+		if want := fpFor(c.BloomM, c.BloomK, int(c.N)); c.FP != want {
+			t.Fatalf("entry %d kept fp %v, want %v for its m, k and n", i+1, c.FP, want)
+		}
+	}
+	_, err = LoadManifest(writeInput(t, "manifest.json", []byte(`[{"fp": 0.01}]`)), base)
+	if err == nil || !strings.Contains(err.Error(), "contradicts -bloom-m and -bloom-k") {
+		t.Fatalf("got %v for an entry with an fp of its own, want the contradiction", err)
+	}
+
+	// a flat config pinned by an entry of its own
+	cfgs, err = LoadManifest(writeInput(t, "manifest.json", []byte(`[{"BloomM": 65536, "BloomK": 4}]`)), validConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fpFor(1<<16, 4, int(cfgs[0].N)); cfgs[0].FP != want {
+		t.Fatalf("entry pinned fp %v, want %v", cfgs[0].FP, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// reloads the map and filters a compare run saved to -outdir into a fresh
+// state and confirms them as if they had been built. catches a save that
+// lost data or a format that drifted between encode and decode
+func RunVerifyArtifacts(cfg *Config) {
+	if err := verifyArtifacts(cfg); err != nil {
+		log.Fatalf("artifacts failed verification: %v", err)
+	}
+}
+
+func verifyArtifacts(cfg *Config) error {
+	fils, err := newFilters(cfg)
+	if err != nil {
+		return fmt.Errorf("bad -filters %q: %w", cfg.Filters, err)
+	}
+	// nothing is read, no pass can have ended short
+	cfg.state = runState{}
+
+	set, err := LoadMap(artifactPath("mapBytes.gob"))
+	if err != nil {
+		return fmt.Errorf("loading map artifact: %w", err)
+	}
+	var drift error
+	for _, f := range fils {
+		hdr, payload, err := LoadArtifact(f.File())
+		if err != nil {
+			return fmt.Errorf("loading bloom artifact: %w", err)
+		}
+		f.fil = &bloom.BloomFilter{}
+		if err := f.fil.GobDecode(payload); err != nil {
+			return fmt.Errorf("decoding %s: %w", f.File(), err)
+		}
+		if hdr == nil {
+			slog.Warn("artifact has no header, nothing to compare the estimate with", "file", f.File())
+			continue
+		}
+		if hdr.HashSeed != cfg.HashSeed {
+			drift = errors.Join(drift, fmt.Errorf("%s was saved under -hash-seed %d, this run uses %d", f.File(), hdr.HashSeed, cfg.HashSeed))
+		}
+		if hdr.Entries != len(set) {
+			drift = errors.Join(drift, fmt.Errorf("%s was saved with %d entries, the map has %d", f.File(), hdr.Entries, len(set)))
+		}
+		if hdr.Approx != f.fil.ApproximatedSize() {
+			drift = errors.Join(drift, fmt.Errorf("%s estimated %d distinct when saved, %d loaded", f.File(), hdr.Approx, f.fil.ApproximatedSize()))
+		}
+	}
+
+	_, err = Confirm(cfg, set, fils)
+	if err = errors.Join(drift, err); err != nil {
+		return err
+	}
+	slog.Info("artifacts verified", "entries", len(set), "filters", len(fils))
+	return nil
+}
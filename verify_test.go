@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// the whole compare run into a temp dir, then everything it saved loaded
+// back into a fresh state: no key of the map may miss and each filter has
+// to estimate what it did before it was saved
+func TestSavedArtifactsConfirm(t *testing.T) {
+	cfg := testConfig(writeInput(t, "events.json", encodeEvents(t, testEvents(3000), FORMAT_ARRAY)))
+	cfg.N, cfg.FP, cfg.HalfRatio = 2000, 0.01, 0.5
+	cfg.Filters = FILTER_BOTH
+	cfg.OutDir = t.TempDir()
+	saved := outDir
+	t.Cleanup(func() { outDir = saved })
+	if err := setupOutDir(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := RunCompare(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Entries != 2000 {
+		t.Fatalf("saved %d entries, want 2000", res.Entries)
+	}
+
+	set, err := LoadMap(artifactPath("mapBytes.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != res.Entries {
+		t.Fatalf("loaded %d map entries, saved %d", len(set), res.Entries)
+	}
+	fils, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range fils {
+		if f.fil, err = LoadBloom(f.File()); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := f.fil.ApproximatedSize(), res.Filters[i].Approx; got != want {
+			t.Fatalf("%s estimates %d loaded, %d before saving", f.name, got, want)
+		}
+		if missing := falseNegatives(f, keysOf(set)); len(missing) > 0 {
+			t.Fatalf("%s misses %d saved keys e.g %q", f.name, len(missing), missing[0])
+		}
+	}
+	if _, err := Confirm(cfg, set, fils); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyArtifacts(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
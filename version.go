@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+const BLOOM_MODULE = "github.com/bits-and-blooms/bloom/v3"
+
+// identifies the build that produced a result
+type BuildInfo struct {
+	Module  string `json:"module"`
+	Version string `json:"version"`
+	Go      string `json:"go"`
+	Bloom   string `json:"bloom"`
+}
+
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{Go: runtime.Version(), Version: "unknown", Bloom: "unknown"}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = bi.Main.Path
+	if bi.Main.Version != "" {
+		info.Version = bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == BLOOM_MODULE {
+			info.Bloom = dep.Version
+			if dep.Replace != nil {
+				info.Bloom = dep.Replace.Version
+			}
+		}
+	}
+	return info
+}
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("%s %s (%s, bloom %s)", b.Module, b.Version, b.Go, b.Bloom)
+}